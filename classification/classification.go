@@ -0,0 +1,131 @@
+// Package classification validates library classification numbers in the
+// Universal Decimal Classification (UKD in Polish libraries) and the Dewey
+// Decimal Classification, and builds call numbers from them. Every number has
+// a sort key, so that sorting call numbers by their keys as plain bytes puts
+// the books in shelf order.
+package classification
+
+import (
+	"books_rent/search"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// The classification schemes.
+const (
+	UDC = "udc"
+	DDC = "ddc"
+)
+
+var (
+	ErrScheme = errors.New("classification scheme must be udc or ddc")
+	ErrSyntax = errors.New("invalid classification number")
+)
+
+// Number is a classification number that follows the syntax of its scheme.
+type Number struct {
+	Scheme string
+	Text   string
+	key    string
+}
+
+// deweyPattern matches a Dewey number: three digits, then optionally a point
+// and further digits.
+var deweyPattern = regexp.MustCompile(`^[0-9]{3}(\.[0-9]+)?$`)
+
+// maxLength is the longest number accepted, and the longest title prefix kept
+// in a sort key, which keeps sort keys within 255 bytes.
+const maxLength = 100
+
+// Parse validates a number in the given scheme. Surrounding spaces are ignored.
+func Parse(scheme, text string) (Number, error) {
+	text = strings.TrimSpace(text)
+	if len(text) > maxLength {
+		return Number{}, fmt.Errorf("%w: longer than %d characters", ErrSyntax, maxLength)
+	}
+	switch scheme {
+	case UDC:
+		key, err := udcKey(text)
+		if err != nil {
+			return Number{}, err
+		}
+		return Number{Scheme: scheme, Text: text, key: key}, nil
+	case DDC:
+		if !deweyPattern.MatchString(text) {
+			return Number{}, fmt.Errorf("%w: %q is not a Dewey number like 823.914", ErrSyntax, text)
+		}
+		return Number{Scheme: scheme, Text: text, key: text}, nil
+	}
+	return Number{}, ErrScheme
+}
+
+// CallNumber builds the call number of a book shelved under n. The number is
+// followed by the first three letters of the main author's surname and the
+// first letter of the title, as in "821.162.1 MIC p". A book without an author
+// is marked with its title. It also returns the sort key of the call number.
+func (n Number) CallNumber(author, title string) (callNumber, sortKey string) {
+	mark := letters(surname(author), 3)
+	if mark == "" {
+		mark = letters(title, 3)
+	}
+	mark = strings.ToUpper(mark)
+	callNumber = n.Text
+	if mark != "" {
+		callNumber += " " + mark + " " + strings.ToLower(letters(title, 1))
+	}
+	sortKey = n.Scheme + " " + n.key + string(keyEnd) + asciiKey(mark) + " " + truncate(asciiKey(title), maxLength)
+	return strings.TrimSpace(callNumber), sortKey
+}
+
+// surname returns the surname of an author written as "Surname, Forenames" or
+// as "Forenames Surname".
+func surname(author string) string {
+	if before, _, ok := strings.Cut(author, ","); ok {
+		return before
+	}
+	fields := strings.Fields(author)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+// letters returns the first n letters of s, skipping everything else.
+func letters(s string, n int) string {
+	var b strings.Builder
+	for _, r := range s {
+		if n == 0 {
+			break
+		}
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+			n--
+		}
+	}
+	return b.String()
+}
+
+// asciiKey folds s for sorting: Polish letters become their base letters and
+// only ASCII letters and digits are kept, upper-cased.
+func asciiKey(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= '0' && r <= '9':
+			return r
+		}
+		return -1
+	}, search.Fold(s))
+}
+
+// truncate cuts the ASCII string s to at most n bytes.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package classification
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		scheme, text string
+		wantErr      error
+	}{
+		{UDC, "821.162.1", nil},
+		{UDC, ` 821.162.1-31"19":94(438) `, nil},
+		{UDC, `94(438)"1939/1945"`, nil},
+		{UDC, "(438-25)", nil},
+		{UDC, "(=162.1)", nil},
+		{UDC, "(075.8)", nil},
+		{UDC, "004.43+004.45", nil},
+		{UDC, "37.015.3::159.9", nil},
+		{UDC, "811.162.1'373", nil},
+		{UDC, "821.111=162.1", nil},
+		{UDC, "004.0", nil},
+		{DDC, "823.914", nil},
+		{DDC, "500", nil},
+		{UDC, "", ErrSyntax},
+		{UDC, "8211", ErrSyntax},
+		{UDC, "821.", ErrSyntax},
+		{UDC, "821:", ErrSyntax},
+		{UDC, "94(438", ErrSyntax},
+		{UDC, `94"19`, ErrSyntax},
+		{UDC, `94""`, ErrSyntax},
+		{UDC, "abc", ErrSyntax},
+		{UDC, "821 162", ErrSyntax},
+		{UDC, strings.Repeat("1", 101), ErrSyntax},
+		{DDC, "82", ErrSyntax},
+		{DDC, "823.", ErrSyntax},
+		{DDC, "823.9a", ErrSyntax},
+		{"lcc", "PR6045", ErrScheme},
+		{"", "821", ErrScheme},
+	}
+	for _, tt := range tests {
+		n, err := Parse(tt.scheme, tt.text)
+		if !errors.Is(err, tt.wantErr) || (tt.wantErr != nil) != (err != nil) {
+			t.Errorf("Parse(%q, %q) error = %v, want %v", tt.scheme, tt.text, err, tt.wantErr)
+			continue
+		}
+		if err == nil && n.Text != strings.TrimSpace(tt.text) {
+			t.Errorf("Parse(%q, %q).Text = %q", tt.scheme, tt.text, n.Text)
+		}
+	}
+}
+
+func TestCallNumber(t *testing.T) {
+	tests := []struct {
+		text, author, title string
+		callNumber, sortKey string
+	}{
+		{"821.162.1", "Mickiewicz, Adam", "Pan Tadeusz", "821.162.1 MIC p", "udc 8211621 MIC PANTADEUSZ"},
+		{"821.162.1", "Adam Mickiewicz", "Pan Tadeusz", "821.162.1 MIC p", "udc 8211621 MIC PANTADEUSZ"},
+		{"821.162.1", "Żeromski, Stefan", "Ludzie bezdomni", "821.162.1 ŻER l", "udc 8211621 ZER LUDZIEBEZDOMNI"},
+		{"821.162.1", "", "\"Ogniem i mieczem\"", "821.162.1 OGN o", "udc 8211621 OGN OGNIEMIMIECZEM"},
+		{"94(438)", "", "", "94(438)", "udc 94%438  "},
+	}
+	for _, tt := range tests {
+		n, err := Parse(UDC, tt.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		callNumber, sortKey := n.CallNumber(tt.author, tt.title)
+		if callNumber != tt.callNumber || sortKey != tt.sortKey {
+			t.Errorf("CallNumber(%q, %q) of %s = %q, %q; want %q, %q", tt.author, tt.title, tt.text, callNumber, sortKey, tt.callNumber, tt.sortKey)
+		}
+	}
+}
+
+// TestUDCFilingOrder checks that sorting by key puts numbers in the UDC filing
+// order: a number alone, then with each connecting sign and auxiliary in turn,
+// then its subdivisions. A point after a group of three digits continues the
+// main number, so .0 is an auxiliary only after a shorter group, as in 82.0.
+func TestUDCFilingOrder(t *testing.T) {
+	shelf := []string{
+		"82",
+		"82+93",
+		"82:93",
+		"82=111",
+		"82(075)",
+		"82(438)",
+		"82(=162.1)",
+		`82"19"`,
+		"82-3",
+		"82.0",
+		"82'1",
+		"821",
+		"821.1",
+		"821.111",
+		"821.162.1",
+		"821.162.1-3",
+		"822",
+	}
+	checkOrder(t, shelf, func(text string) string {
+		n, err := Parse(UDC, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n.key
+	})
+}
+
+func TestCallNumberOrder(t *testing.T) {
+	type book struct{ number, author, title string }
+	shelf := []book{
+		{"821.162.1", "Mickiewicz, Adam", "Dziady"},
+		{"821.162.1", "Mickiewicz, Adam", "Pan Tadeusz"},
+		{"821.162.1", "Sienkiewicz, Henryk", "Potop"},
+		{"821.162.1", "Żeromski, Stefan", "Przedwiośnie"},
+		{"821.162.1-3", "Lem, Stanisław", "Solaris"},
+		{"821.162.1-31", "Prus, Bolesław", "Lalka"},
+	}
+	keys := map[string]book{}
+	var texts []string
+	for _, b := range shelf {
+		text := b.number + "|" + b.author + "|" + b.title
+		texts = append(texts, text)
+		keys[text] = b
+	}
+	checkOrder(t, texts, func(text string) string {
+		b := keys[text]
+		n, err := Parse(UDC, b.number)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, sortKey := n.CallNumber(b.author, b.title)
+		return sortKey
+	})
+}
+
+// checkOrder shuffles items by reversing them, sorts them by key as plain
+// bytes and checks that they come back in their original order.
+func checkOrder(t *testing.T, items []string, key func(string) string) {
+	t.Helper()
+	sorted := make([]string, len(items))
+	for i, item := range items {
+		sorted[len(items)-1-i] = item
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return key(sorted[i]) < key(sorted[j]) })
+	for i := range items {
+		if sorted[i] != items[i] {
+			t.Errorf("position %d: got %s (key %q), want %s (key %q)", i, sorted[i], key(sorted[i]), items[i], key(items[i]))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package classification
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The UDC filing order puts the connecting signs and the common auxiliaries
+// before the digits, in the order below, and a shorter number before the
+// numbers it starts. The sort key replaces each sign with a byte below '0'
+// that keeps this order, and drops the points, which only group the digits.
+const (
+	keyEnd         = ' '
+	keyAddition    = '!'  // + and /
+	keyRelation    = '"'  // : and ::
+	keyLanguage    = '#'  // =
+	keyForm        = '$'  // (0
+	keyPlace       = '%'  // (1 to (9
+	keyEthnic      = '&'  // (=
+	keyTime        = '\'' // "
+	keySpecial     = '('  // -
+	keyPointNought = ')'  // .0
+	keyApostrophe  = '*'  // '
+)
+
+// udcKey validates a UDC number such as 821.162.1-31"19":94(438) and returns
+// its sort key.
+func udcKey(text string) (string, error) {
+	p := udcParser{text: text}
+	if err := p.parse(); err != nil {
+		return "", err
+	}
+	return p.key.String(), nil
+}
+
+// udcParser reads a UDC number: main numbers and parenthesised place, form
+// and ethnic numbers, with auxiliaries attached, joined by the connecting
+// signs + / : and ::.
+type udcParser struct {
+	text string
+	pos  int
+	key  strings.Builder
+}
+
+func (p *udcParser) fail(expected string) error {
+	if p.pos >= len(p.text) {
+		return fmt.Errorf("%w: %q ends where %s was expected", ErrSyntax, p.text, expected)
+	}
+	return fmt.Errorf("%w: %s expected at position %d of %q", ErrSyntax, expected, p.pos+1, p.text)
+}
+
+func (p *udcParser) peek(offset int) byte {
+	if p.pos+offset < len(p.text) {
+		return p.text[p.pos+offset]
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *udcParser) parse() error {
+	if err := p.element(); err != nil {
+		return err
+	}
+	for p.pos < len(p.text) {
+		switch p.peek(0) {
+		case '+', '/':
+			p.pos++
+			p.key.WriteByte(keyAddition)
+		case ':':
+			p.pos++
+			if p.peek(0) == ':' {
+				p.pos++
+			}
+			p.key.WriteByte(keyRelation)
+		default:
+			return p.fail("a connecting sign")
+		}
+		if err := p.element(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// element reads a main number or a parenthesised number and the auxiliaries
+// that follow it.
+func (p *udcParser) element() error {
+	start := p.pos
+	if isDigit(p.peek(0)) {
+		if err := p.number(); err != nil {
+			return err
+		}
+	}
+	for {
+		var err error
+		switch c := p.peek(0); {
+		case c == '=':
+			p.pos++
+			p.key.WriteByte(keyLanguage)
+			err = p.number()
+		case c == '(':
+			err = p.parenthesised()
+		case c == '"':
+			err = p.time()
+		case c == '-':
+			p.pos++
+			p.key.WriteByte(keySpecial)
+			err = p.number()
+		case c == '.' && p.peek(1) == '0':
+			p.pos++
+			p.key.WriteByte(keyPointNought)
+			err = p.number()
+		case c == '\'':
+			p.pos++
+			p.key.WriteByte(keyApostrophe)
+			err = p.number()
+		default:
+			if p.pos == start {
+				return p.fail("a UDC number")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// number reads digits divided by a point after every third one, as in
+// 821.162.1.
+func (p *udcParser) number() error {
+	if !isDigit(p.peek(0)) {
+		return p.fail("a digit")
+	}
+	for {
+		group := 0
+		for isDigit(p.peek(0)) {
+			p.key.WriteByte(p.peek(0))
+			p.pos++
+			group++
+		}
+		if group > 3 {
+			return fmt.Errorf("%w: %q needs a point after every third digit", ErrSyntax, p.text)
+		}
+		if group < 3 || p.peek(0) != '.' || !isDigit(p.peek(1)) {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+// parenthesised reads a place (4), form (0...) or ethnic (=...) auxiliary.
+// Place numbers may be subdivided with a hyphen, as in (438-25).
+func (p *udcParser) parenthesised() error {
+	p.pos++
+	switch c := p.peek(0); {
+	case c == '=':
+		p.pos++
+		p.key.WriteByte(keyEthnic)
+	case c == '0':
+		p.key.WriteByte(keyForm)
+	default:
+		p.key.WriteByte(keyPlace)
+	}
+	if err := p.number(); err != nil {
+		return err
+	}
+	for p.peek(0) == '-' {
+		p.pos++
+		p.key.WriteByte(keySpecial)
+		if err := p.number(); err != nil {
+			return err
+		}
+	}
+	if p.peek(0) != ')' {
+		return p.fail("a closing parenthesis")
+	}
+	p.pos++
+	return nil
+}
+
+// time reads a time auxiliary: a date or period in quotes, as in "1939/1945".
+func (p *udcParser) time() error {
+	p.pos++
+	p.key.WriteByte(keyTime)
+	if !isDigit(p.peek(0)) {
+		return p.fail("a digit")
+	}
+	for {
+		switch c := p.peek(0); {
+		case isDigit(c), c == '.', c == '/', c == '-':
+			p.key.WriteByte(c)
+			p.pos++
+		case c == '"':
+			p.pos++
+			return nil
+		default:
+			return p.fail("a closing quote")
+		}
+	}
+}
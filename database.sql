@@ -4,7 +4,11 @@
 CREATE TABLE Users (
     UserID INT AUTO_INCREMENT PRIMARY KEY,
     Name VARCHAR(100),
-    Email VARCHAR(100) UNIQUE
+    Email VARCHAR(100) UNIQUE,
+    PasswordHash VARCHAR(255),
+    Role VARCHAR(20) NOT NULL DEFAULT 'patron',
+    Status VARCHAR(20) NOT NULL DEFAULT 'active',
+    ExpiryDate DATE
 );
 
 -- Tabela Authors
@@ -25,30 +29,92 @@ CREATE TABLE Publishers (
 CREATE TABLE Categories (
     CategoryID INT AUTO_INCREMENT PRIMARY KEY,
     Name VARCHAR(100),
+    Description TEXT,
+    ParentID INT,
+    FOREIGN KEY (ParentID) REFERENCES Categories(CategoryID)
+);
+
+-- Tabela Series (cykle i serie, w których ukazują się utwory)
+CREATE TABLE Series (
+    SeriesID INT AUTO_INCREMENT PRIMARY KEY,
+    Name VARCHAR(100),
     Description TEXT
 );
 
+-- Tabela Works (utwory; książki są ich wydaniami i przekładami)
+CREATE TABLE Works (
+    WorkID INT AUTO_INCREMENT PRIMARY KEY,
+    Title VARCHAR(100),
+    OriginalLanguage CHAR(3),
+    SeriesID INT,
+    SeriesVolume INT,
+    FOREIGN KEY (SeriesID) REFERENCES Series(SeriesID)
+);
+
 
 CREATE TABLE Books (
     BookID INT AUTO_INCREMENT PRIMARY KEY,
     Title VARCHAR(100),
-    AuthorID INT,
+    ISBN13 CHAR(13) UNIQUE,
     PublisherID INT,
-    CategoryID INT,
-    Available BOOLEAN DEFAULT TRUE,
-    FOREIGN KEY (AuthorID) REFERENCES Authors(AuthorID),
+    WorkID INT,
+    PublicationYear SMALLINT,
+    Language CHAR(3),
+    ClassificationScheme VARCHAR(3),
+    Classification VARCHAR(100),
+    CallNumber VARCHAR(150),
+    CallNumberSort VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin,
     FOREIGN KEY (PublisherID) REFERENCES Publishers(PublisherID),
+    FOREIGN KEY (WorkID) REFERENCES Works(WorkID),
+    INDEX (CallNumberSort)
+);
+
+-- Tabela BookAuthors (współtwórcy książek w kolejności ze strony tytułowej)
+CREATE TABLE BookAuthors (
+    BookID INT NOT NULL,
+    AuthorID INT NOT NULL,
+    Role VARCHAR(20) NOT NULL DEFAULT 'author',
+    Position INT NOT NULL,
+    PRIMARY KEY (BookID, Position),
+    UNIQUE (BookID, AuthorID, Role),
+    FOREIGN KEY (BookID) REFERENCES Books(BookID) ON DELETE CASCADE,
+    FOREIGN KEY (AuthorID) REFERENCES Authors(AuthorID)
+);
+
+-- Tabela BookCategories (hasła przedmiotowe książek; pierwsze to kategoria główna)
+CREATE TABLE BookCategories (
+    BookID INT NOT NULL,
+    CategoryID INT NOT NULL,
+    Position INT NOT NULL,
+    PRIMARY KEY (BookID, CategoryID),
+    UNIQUE (BookID, Position),
+    FOREIGN KEY (BookID) REFERENCES Books(BookID) ON DELETE CASCADE,
     FOREIGN KEY (CategoryID) REFERENCES Categories(CategoryID)
 );
 
+-- Tabela Copies (fizyczne egzemplarze książek)
+CREATE TABLE Copies (
+    CopyID INT AUTO_INCREMENT PRIMARY KEY,
+    BookID INT NOT NULL,
+    Barcode VARCHAR(50) NOT NULL UNIQUE,
+    ShelfLocation VARCHAR(50),
+    CopyCondition VARCHAR(20) NOT NULL DEFAULT 'good',
+    Status VARCHAR(20) NOT NULL DEFAULT 'available',
+    FOREIGN KEY (BookID) REFERENCES Books(BookID)
+);
+
 -- Tabela Loans
 CREATE TABLE Loans (
     LoanID INT AUTO_INCREMENT PRIMARY KEY,
     BookID INT,
+    CopyID INT,
     UserID INT,
     LoanDate DATE,
+    DueDate DATE,
     ReturnDate DATE,
+    RenewalCount INT NOT NULL DEFAULT 0,
     FOREIGN KEY (BookID) REFERENCES Books(BookID),
+    FOREIGN KEY (CopyID) REFERENCES Copies(CopyID),
     FOREIGN KEY (UserID) REFERENCES Users(UserID)
 );
 
@@ -56,9 +122,15 @@ CREATE TABLE Loans (
 CREATE TABLE Reservations (
     ReservationID INT AUTO_INCREMENT PRIMARY KEY,
     BookID INT,
+    WorkID INT,
     UserID INT,
     ReservationDate DATE,
+    Status VARCHAR(20) NOT NULL DEFAULT 'waiting',
+    HoldUntil DATE,
+    CopyID INT,
     FOREIGN KEY (BookID) REFERENCES Books(BookID),
+    FOREIGN KEY (WorkID) REFERENCES Works(WorkID),
+    FOREIGN KEY (CopyID) REFERENCES Copies(CopyID),
     FOREIGN KEY (UserID) REFERENCES Users(UserID)
 );
 
@@ -73,31 +145,79 @@ CREATE TABLE Reviews (
     FOREIGN KEY (UserID) REFERENCES Users(UserID)
 );
 
+-- Tabela Fines
+CREATE TABLE Fines (
+    FineID INT AUTO_INCREMENT PRIMARY KEY,
+    LoanID INT NOT NULL,
+    UserID INT NOT NULL,
+    Amount DECIMAL(10,2) NOT NULL,
+    Balance DECIMAL(10,2) NOT NULL,
+    Status VARCHAR(20) NOT NULL DEFAULT 'open',
+    AssessedDate DATE,
+    WaivedBy VARCHAR(100),
+    WaiveReason TEXT,
+    FOREIGN KEY (LoanID) REFERENCES Loans(LoanID),
+    FOREIGN KEY (UserID) REFERENCES Users(UserID)
+);
+
+-- Tabela FineTransactions (księga zmian sald kar, tylko do dopisywania)
+CREATE TABLE FineTransactions (
+    TransactionID INT AUTO_INCREMENT PRIMARY KEY,
+    FineID INT NOT NULL,
+    Type VARCHAR(20) NOT NULL,
+    Amount DECIMAL(10,2) NOT NULL,
+    BalanceAfter DECIMAL(10,2) NOT NULL,
+    RecordedBy VARCHAR(100),
+    Note TEXT,
+    CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (FineID) REFERENCES Fines(FineID)
+);
 
 DELIMITER //
 CREATE TRIGGER AfterBookLoan
 AFTER INSERT ON Loans
 FOR EACH ROW
 BEGIN
-   UPDATE Books SET Available = FALSE WHERE BookID = NEW.BookID;
+   IF NEW.ReturnDate IS NULL THEN
+      UPDATE Copies SET Status = 'on_loan' WHERE CopyID = NEW.CopyID;
+   END IF;
 END;
 
 CREATE TRIGGER BeforeBookReturn
 BEFORE UPDATE ON Loans
 FOR EACH ROW
 BEGIN
-   IF NEW.ReturnDate IS NOT NULL THEN
-      UPDATE Books SET Available = TRUE WHERE BookID = OLD.BookID;
+   IF NEW.ReturnDate IS NOT NULL AND OLD.ReturnDate IS NULL THEN
+      UPDATE Copies SET Status = 'available' WHERE CopyID = OLD.CopyID;
    END IF;
 END;
 
+CREATE TRIGGER FineTransactionsNoUpdate
+BEFORE UPDATE ON FineTransactions
+FOR EACH ROW
+BEGIN
+   SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'FineTransactions is append-only';
+END;
+
+CREATE TRIGGER FineTransactionsNoDelete
+BEFORE DELETE ON FineTransactions
+FOR EACH ROW
+BEGIN
+   SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'FineTransactions is append-only';
+END;
+
 //
 DELIMITER ;
 
 DELIMITER //
 CREATE PROCEDURE LoanBook(IN book_id INT, IN user_id INT)
 BEGIN
-   INSERT INTO Loans (BookID, UserID, LoanDate) VALUES (book_id, user_id, CURDATE());
+   DECLARE copy_id INT;
+   SELECT CopyID INTO copy_id FROM Copies WHERE BookID = book_id AND Status = 'available' ORDER BY CopyID LIMIT 1 FOR UPDATE;
+   IF copy_id IS NULL THEN
+      SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'No copy of the book is available';
+   END IF;
+   INSERT INTO Loans (BookID, CopyID, UserID, LoanDate, DueDate) VALUES (book_id, copy_id, user_id, CURDATE(), CURDATE() + INTERVAL 30 DAY);
 END;
 
 CREATE PROCEDURE ReturnBook(IN loan_id INT)
@@ -127,21 +247,45 @@ BEGIN
    RETURN loan_count;
 END;
 
+CREATE FUNCTION CountActiveUserLoans(user_id INT) RETURNS INT
+BEGIN
+   DECLARE loan_count INT;
+   SELECT COUNT(*) INTO loan_count FROM Loans WHERE UserID = user_id AND ReturnDate IS NULL;
+   RETURN loan_count;
+END;
+
 CREATE FUNCTION CheckBookAvailability(book_id INT) RETURNS BOOLEAN
 BEGIN
-   DECLARE is_available BOOLEAN;
-   SELECT Available INTO is_available FROM Books WHERE BookID = book_id;
-   RETURN is_available;
+   RETURN EXISTS(SELECT 1 FROM Copies WHERE BookID = book_id AND Status = 'available');
 END;
 //
 DELIMITER ;
 
 
+-- AuthorID to główny autor: pierwszy współtwórca z rolą 'author';
+-- CategoryID to kategoria główna: pierwsze hasło przedmiotowe
+CREATE VIEW BookAvailability AS
+SELECT Books.BookID, Books.Title, Books.ISBN13,
+       (SELECT BookAuthors.AuthorID FROM BookAuthors
+        WHERE BookAuthors.BookID = Books.BookID AND BookAuthors.Role = 'author'
+        ORDER BY BookAuthors.Position LIMIT 1) AS AuthorID,
+       Books.PublisherID,
+       (SELECT BookCategories.CategoryID FROM BookCategories
+        WHERE BookCategories.BookID = Books.BookID
+        ORDER BY BookCategories.Position LIMIT 1) AS CategoryID,
+       Books.WorkID, Books.PublicationYear, Books.Language,
+       Books.ClassificationScheme, Books.Classification, Books.CallNumber, Books.CallNumberSort,
+       COUNT(Copies.CopyID) AS TotalCopies,
+       COUNT(CASE WHEN Copies.Status = 'available' THEN 1 END) AS AvailableCopies
+FROM Books
+LEFT JOIN Copies ON Books.BookID = Copies.BookID
+GROUP BY Books.BookID;
+
 CREATE VIEW AvailableBooks AS
-SELECT * FROM Books WHERE Available = TRUE;
+SELECT * FROM BookAvailability WHERE AvailableCopies > 0;
 
 CREATE VIEW UserLoanHistory AS
-SELECT Users.UserID, Users.Name, Books.Title, Loans.LoanDate, Loans.ReturnDate
+SELECT Users.UserID, Users.Name, Books.Title, Loans.LoanDate, Loans.DueDate, Loans.ReturnDate
 FROM Users
 JOIN Loans ON Users.UserID = Loans.UserID
 JOIN Books ON Loans.BookID = Books.BookID;
@@ -1,40 +1,79 @@
--- Insert dummy data into Users
-INSERT INTO Users (Name, Email) VALUES ('Jan Kowalski', 'jan.kowalski@example.com');
-INSERT INTO Users (Name, Email) VALUES ('Anna Nowak', 'anna.nowak@example.com');
-INSERT INTO Users (Name, Email) VALUES ('Piotr Wiśniewski', 'piotr.wisniewski@example.com');
-INSERT INTO Users (Name, Email) VALUES ('Katarzyna Zielińska', 'katarzyna.zielinska@example.com');
+-- Insert dummy data into Users (password for every account: haslo123)
+INSERT INTO Users (Name, Email, PasswordHash, Role) VALUES ('Jan Kowalski', 'jan.kowalski@example.com', '$2a$10$QLIfIT1ChbOFO71qOPHiteIDR.ga9RcqEc07UcVtGpmx6h0Jw31Ny', 'admin');
+INSERT INTO Users (Name, Email, PasswordHash, Role) VALUES ('Anna Nowak', 'anna.nowak@example.com', '$2a$10$QLIfIT1ChbOFO71qOPHiteIDR.ga9RcqEc07UcVtGpmx6h0Jw31Ny', 'librarian');
+INSERT INTO Users (Name, Email, PasswordHash) VALUES ('Piotr Wiśniewski', 'piotr.wisniewski@example.com', '$2a$10$QLIfIT1ChbOFO71qOPHiteIDR.ga9RcqEc07UcVtGpmx6h0Jw31Ny');
+INSERT INTO Users (Name, Email, PasswordHash) VALUES ('Katarzyna Zielińska', 'katarzyna.zielinska@example.com', '$2a$10$QLIfIT1ChbOFO71qOPHiteIDR.ga9RcqEc07UcVtGpmx6h0Jw31Ny');
 
 -- Insert dummy data into Authors
 INSERT INTO Authors (Name, Biography) VALUES ('Henryk Sienkiewicz', 'Polish novelist and Nobel Prize laureate');
 INSERT INTO Authors (Name, Biography) VALUES ('Stanisław Lem', 'A prominent Polish science fiction writer');
 INSERT INTO Authors (Name, Biography) VALUES ('Adam Mickiewicz', 'A principal figure in Polish Romanticism');
 INSERT INTO Authors (Name, Biography) VALUES ('Wislawa Szymborska', 'Nobel Prize-winning Polish poet');
+INSERT INTO Authors (Name, Biography) VALUES ('Joanna Trzeciak', 'American translator of Polish poetry');
+INSERT INTO Authors (Name, Biography) VALUES ('Bill Johnston', 'Translator of Polish literature into English');
 
 -- Insert dummy data into Publishers
 INSERT INTO Publishers (Name, Address) VALUES ('Wydawnictwo Literackie', 'Kraków, Poland');
 INSERT INTO Publishers (Name, Address) VALUES ('Znak', 'Kraków, Poland');
 INSERT INTO Publishers (Name, Address) VALUES ('WAB', 'Warszawa, Poland');
 INSERT INTO Publishers (Name, Address) VALUES ('Czytelnik', 'Warszawa, Poland');
+INSERT INTO Publishers (Name, Address) VALUES ('Pro Auctore', 'Kraków, Poland');
 
 -- Insert dummy data into Categories
 INSERT INTO Categories (Name, Description) VALUES ('Fiction', 'Fiction books');
-INSERT INTO Categories (Name, Description) VALUES ('Science Fiction', 'Science fiction and fantasy');
+INSERT INTO Categories (Name, Description, ParentID) VALUES ('Science Fiction', 'Science fiction and fantasy', 1);
 INSERT INTO Categories (Name, Description) VALUES ('Poetry', 'Collections of poetry');
 INSERT INTO Categories (Name, Description) VALUES ('History', 'Historical books and biographies');
 
+-- Insert dummy data into Series
+INSERT INTO Series (Name, Description) VALUES ('Dzieła Stanisława Lema', 'Collected works of Stanisław Lem');
+
+-- Insert dummy data into Works
+INSERT INTO Works (Title, OriginalLanguage, SeriesID, SeriesVolume) VALUES ('Solaris', 'pol', 1, 1);
+
 -- Insert dummy data into Books
-INSERT INTO Books (Title, AuthorID, PublisherID, CategoryID, Available) VALUES ('Quo Vadis', 1, 1, 4, TRUE);
-INSERT INTO Books (Title, AuthorID, PublisherID, CategoryID, Available) VALUES ('Solaris', 2, 2, 2, FALSE);
-INSERT INTO Books (Title, AuthorID, PublisherID, CategoryID, Available) VALUES ('Pan Tadeusz', 3, 3, 1, TRUE);
-INSERT INTO Books (Title, AuthorID, PublisherID, CategoryID, Available) VALUES ('Miracle Fair', 4, 4, 3, TRUE);
+INSERT INTO Books (Title, ISBN13, PublisherID, WorkID, PublicationYear, Language, ClassificationScheme, Classification, CallNumber, CallNumberSort) VALUES ('Quo Vadis', '9788308010006', 1, NULL, 2016, 'pol', 'udc', '821.162.1-311.6', '821.162.1-311.6 SIE q', 'udc 8211621(3116 SIE QUOVADIS');
+INSERT INTO Books (Title, ISBN13, PublisherID, WorkID, PublicationYear, Language, ClassificationScheme, Classification, CallNumber, CallNumberSort) VALUES ('Solaris', '9788308010013', 2, 1, 2012, 'pol', 'udc', '821.162.1-3', '821.162.1-3 LEM s', 'udc 8211621(3 LEM SOLARIS');
+INSERT INTO Books (Title, ISBN13, PublisherID, WorkID, PublicationYear, Language, ClassificationScheme, Classification, CallNumber, CallNumberSort) VALUES ('Pan Tadeusz', '9788308010020', 3, NULL, 2011, 'pol', 'udc', '821.162.1-13', '821.162.1-13 MIC p', 'udc 8211621(13 MIC PANTADEUSZ');
+INSERT INTO Books (Title, ISBN13, PublisherID, WorkID, PublicationYear, Language, ClassificationScheme, Classification, CallNumber, CallNumberSort) VALUES ('Miracle Fair', '9788308010037', 4, NULL, 2001, 'eng', 'ddc', '891.8517', '891.8517 SZY m', 'ddc 891.8517 SZY MIRACLEFAIR');
+INSERT INTO Books (Title, ISBN13, PublisherID, WorkID, PublicationYear, Language, ClassificationScheme, Classification, CallNumber, CallNumberSort) VALUES ('Solaris', '9788308010044', 5, 1, 2011, 'eng', 'ddc', '891.8537', '891.8537 LEM s', 'ddc 891.8537 LEM SOLARIS');
+
+-- Insert dummy data into BookAuthors
+INSERT INTO BookAuthors (BookID, AuthorID, Role, Position) VALUES (1, 1, 'author', 1);
+INSERT INTO BookAuthors (BookID, AuthorID, Role, Position) VALUES (2, 2, 'author', 1);
+INSERT INTO BookAuthors (BookID, AuthorID, Role, Position) VALUES (3, 3, 'author', 1);
+INSERT INTO BookAuthors (BookID, AuthorID, Role, Position) VALUES (4, 4, 'author', 1);
+INSERT INTO BookAuthors (BookID, AuthorID, Role, Position) VALUES (4, 5, 'translator', 2);
+INSERT INTO BookAuthors (BookID, AuthorID, Role, Position) VALUES (5, 2, 'author', 1);
+INSERT INTO BookAuthors (BookID, AuthorID, Role, Position) VALUES (5, 6, 'translator', 2);
+
+-- Insert dummy data into BookCategories
+INSERT INTO BookCategories (BookID, CategoryID, Position) VALUES (1, 4, 1);
+INSERT INTO BookCategories (BookID, CategoryID, Position) VALUES (1, 1, 2);
+INSERT INTO BookCategories (BookID, CategoryID, Position) VALUES (2, 2, 1);
+INSERT INTO BookCategories (BookID, CategoryID, Position) VALUES (3, 1, 1);
+INSERT INTO BookCategories (BookID, CategoryID, Position) VALUES (3, 3, 2);
+INSERT INTO BookCategories (BookID, CategoryID, Position) VALUES (4, 3, 1);
+INSERT INTO BookCategories (BookID, CategoryID, Position) VALUES (5, 2, 1);
+
+-- Insert dummy data into Copies
+INSERT INTO Copies (BookID, Barcode, ShelfLocation, CopyCondition, Status) VALUES (1, 'BK00000001', 'A1-01', 'good', 'on_loan');
+INSERT INTO Copies (BookID, Barcode, ShelfLocation, CopyCondition, Status) VALUES (1, 'BK00000002', 'A1-01', 'new', 'available');
+INSERT INTO Copies (BookID, Barcode, ShelfLocation, CopyCondition, Status) VALUES (2, 'BK00000003', 'B2-04', 'poor', 'in_repair');
+INSERT INTO Copies (BookID, Barcode, ShelfLocation, CopyCondition, Status) VALUES (3, 'BK00000004', 'A3-02', 'fair', 'available');
+INSERT INTO Copies (BookID, Barcode, ShelfLocation, CopyCondition, Status) VALUES (3, 'BK00000005', 'A3-02', 'good', 'available');
+INSERT INTO Copies (BookID, Barcode, ShelfLocation, CopyCondition, Status) VALUES (4, 'BK00000006', 'C1-07', 'good', 'lost');
+INSERT INTO Copies (BookID, Barcode, ShelfLocation, CopyCondition, Status) VALUES (5, 'BK00000007', 'C2-03', 'new', 'on_loan');
 
 -- Insert dummy data into Loans
-INSERT INTO Loans (BookID, UserID, LoanDate, ReturnDate) VALUES (1, 1, '2024-01-01', NULL);
-INSERT INTO Loans (BookID, UserID, LoanDate, ReturnDate) VALUES (3, 2, '2024-01-05', '2024-02-05');
+INSERT INTO Loans (BookID, CopyID, UserID, LoanDate, DueDate, ReturnDate) VALUES (1, 1, 1, '2024-01-01', '2024-01-31', NULL);
+INSERT INTO Loans (BookID, CopyID, UserID, LoanDate, DueDate, ReturnDate) VALUES (3, 4, 2, '2024-01-05', '2024-02-04', '2024-02-05');
+INSERT INTO Loans (BookID, CopyID, UserID, LoanDate, DueDate, ReturnDate) VALUES (5, 7, 2, '2024-01-08', '2024-02-07', NULL);
 
 -- Insert dummy data into Reservations
 INSERT INTO Reservations (BookID, UserID, ReservationDate) VALUES (2, 3, '2024-01-10');
 INSERT INTO Reservations (BookID, UserID, ReservationDate) VALUES (4, 4, '2024-01-15');
+INSERT INTO Reservations (WorkID, UserID, ReservationDate) VALUES (1, 4, '2024-01-20');
 
 -- Insert dummy data into Reviews
 INSERT INTO Reviews (BookID, UserID, Rating, Comment) VALUES (1, 1, 5, 'Klasyczna powieść historyczna, polecam!');
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Token types carried in the "typ" claim, so that a refresh token cannot be
+// used to call the API and an access token cannot be refreshed.
+const (
+	accessToken  = "access"
+	refreshToken = "refresh"
+)
+
+// userContextKey is the gin context key holding the authenticated user.
+const userContextKey = "user"
+
+type AuthHandler struct {
+	DB         *sql.DB
+	Secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+func NewAuthHandler(db *sql.DB, secret []byte, accessTTL, refreshTTL time.Duration) *AuthHandler {
+	return &AuthHandler{DB: db, Secret: secret, AccessTTL: accessTTL, RefreshTTL: refreshTTL}
+}
+
+type tokenClaims struct {
+	TokenType string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// hashPassword returns the bcrypt hash stored in Users.PasswordHash.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func (h *AuthHandler) signToken(userID int, tokenType string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := tokenClaims{
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(h.Secret)
+}
+
+func (h *AuthHandler) issueTokens(userID int) (models.TokenPair, error) {
+	access, err := h.signToken(userID, accessToken, h.AccessTTL)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	refresh, err := h.signToken(userID, refreshToken, h.RefreshTTL)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	return models.TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(h.AccessTTL.Seconds()),
+	}, nil
+}
+
+// parseToken validates a signed token of the given type and returns the ID of
+// the user it was issued to.
+func (h *AuthHandler) parseToken(token, tokenType string) (int, error) {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return h.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, err
+	}
+	if claims.TokenType != tokenType {
+		return 0, errors.New("wrong token type")
+	}
+	return strconv.Atoi(claims.Subject)
+}
+
+// Login godoc
+// @Summary Log in
+// @Description Exchange an email and password for an access token and a refresh token
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param credentials body models.Credentials true "Credentials"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/login [post]
+func (h *AuthHandler) Login(c *gin.Context) {
+	var credentials models.Credentials
+	if err := c.ShouldBindJSON(&credentials); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	var userID int
+	var passwordHash sql.NullString
+	err := h.DB.QueryRow("SELECT UserID, PasswordHash FROM Users WHERE Email = ?", credentials.Email).Scan(&userID, &passwordHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(c, err)
+		return
+	}
+	if err != nil || !passwordHash.Valid || bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(credentials.Password)) != nil {
+		writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Invalid email or password")
+		return
+	}
+
+	tokens, err := h.issueTokens(userID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Refresh godoc
+// @Summary Refresh tokens
+// @Description Exchange a valid refresh token for a new access token and refresh token
+// @Tags auth
+// @Accept  json
+// @Produce  json
+// @Param refresh body models.RefreshRequest true "Refresh token"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} models.Problem
+// @Failure 401 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var request models.RefreshRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	userID, err := h.parseToken(request.RefreshToken, refreshToken)
+	if err != nil {
+		writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Invalid refresh token")
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Users WHERE UserID = ?)", userID).Scan(&exists); err != nil {
+		writeError(c, err)
+		return
+	}
+	if !exists {
+		writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	tokens, err := h.issueTokens(userID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RequireAuth is a middleware that rejects requests without a valid bearer
+// access token and stores the authenticated user in the request context.
+func (h *AuthHandler) RequireAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Missing bearer token")
+			return
+		}
+		userID, err := h.parseToken(token, accessToken)
+		if err != nil {
+			writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Invalid access token")
+			return
+		}
+
+		var user models.User
+		var expiryDate sql.NullString
+		err = h.DB.QueryRow("SELECT UserID, Name, Email, Role, Status, ExpiryDate FROM Users WHERE UserID = ?", userID).Scan(&user.UserID, &user.Name, &user.Email, &user.Role, &user.Status, &expiryDate)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Invalid access token")
+			} else {
+				writeError(c, err)
+			}
+			return
+		}
+		user.ExpiryDate = parseDate(expiryDate)
+
+		c.Set(userContextKey, user)
+		c.Next()
+	}
+}
+
+// CurrentUser returns the user authenticated by RequireAuth.
+func CurrentUser(c *gin.Context) (models.User, bool) {
+	value, ok := c.Get(userContextKey)
+	if !ok {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
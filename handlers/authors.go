@@ -2,46 +2,74 @@ package handlers
 
 import (
 	"books_rent/models"
+	"books_rent/search"
 	"database/sql"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
 )
 
 type AuthorHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Search *search.Index
 }
 
-func NewAuthorHandler(db *sql.DB) *AuthorHandler {
-	return &AuthorHandler{DB: db}
+func NewAuthorHandler(db *sql.DB, index *search.Index) *AuthorHandler {
+	return &AuthorHandler{DB: db, Search: index}
+}
+
+// scanAuthor reads the AuthorID, Name and Biography columns. Authors created
+// by an import have no biography.
+func scanAuthor(row rowScanner, author *models.Author) error {
+	var name, biography sql.NullString
+	if err := row.Scan(&author.AuthorID, &name, &biography); err != nil {
+		return err
+	}
+	author.Name = name.String
+	author.Biography = biography.String
+	return nil
 }
 
 // GetAuthors godoc
 // @Summary Get a list of authors
-// @Description Get a list of all authors
+// @Description Get a page of authors, optionally filtered by a fragment of the name
 // @Tags authors
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Author
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, name" default(id)
+// @Param name query string false "Fragment of the name"
+// @Success 200 {object} models.Page[models.Author]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /authors [get]
 func (h *AuthorHandler) GetAuthors(c *gin.Context) {
-	var authors []models.Author
-	rows, err := h.DB.Query("SELECT * FROM Authors")
+	q := newListQuery(c, map[string]string{"id": "AuthorID", "name": "Name"}, "id")
+	q.filterContains("name", "Name")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, "AuthorID, Name, Biography", "Authors")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
+	authors := []models.Author{}
 	for rows.Next() {
 		var author models.Author
-		if err := rows.Scan(&author.AuthorID, &author.Name, &author.Biography); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := scanAuthor(rows, &author); err != nil {
+			writeError(c, err)
 			return
 		}
 		authors = append(authors, author)
 	}
-	c.JSON(http.StatusOK, authors)
+	c.JSON(http.StatusOK, newPage(q, authors, total))
 }
 
 // CreateAuthor godoc
@@ -52,28 +80,37 @@ func (h *AuthorHandler) GetAuthors(c *gin.Context) {
 // @Produce  json
 // @Param author body models.Author true "Create Author"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /authors [post]
 func (h *AuthorHandler) CreateAuthor(c *gin.Context) {
 	var author models.Author
-	if err := c.BindJSON(&author); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&author); err != nil {
+		writeBindError(c, err)
 		return
 	}
 
 	stmt, err := h.DB.Prepare("INSERT INTO Authors (Name, Biography) VALUES (?, ?)")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(author.Name, author.Biography)
+	result, err := stmt.Exec(author.Name, author.Biography)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	h.Search.PutAuthor(int(id), author.Name, author.Biography)
 	c.JSON(http.StatusCreated, gin.H{"message": "Author created"})
 }
 
@@ -85,18 +122,19 @@ func (h *AuthorHandler) CreateAuthor(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "Author ID"
 // @Success 200 {object} models.Author
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /authors/{id} [get]
 func (h *AuthorHandler) GetAuthorByID(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var author models.Author
-	err := h.DB.QueryRow("SELECT * FROM Authors WHERE AuthorID = ?", id).Scan(&author.AuthorID, &author.Name, &author.Biography)
+	err := scanAuthor(h.DB.QueryRow("SELECT AuthorID, Name, Biography FROM Authors WHERE AuthorID = ?", id), &author)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Author not found"})
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Author not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 		}
 		return
 	}
@@ -112,22 +150,36 @@ func (h *AuthorHandler) GetAuthorByID(c *gin.Context) {
 // @Param id path int true "Author ID"
 // @Param author body models.Author true "Update Author"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /authors/{id} [put]
 func (h *AuthorHandler) UpdateAuthor(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var author models.Author
-	if err := c.BindJSON(&author); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&author); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Authors WHERE AuthorID = ?)", id).Scan(&exists); err != nil {
+		writeError(c, err)
+		return
+	}
+	if !exists {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Author not found")
 		return
 	}
 
 	_, err := h.DB.Exec("UPDATE Authors SET Name = ?, Biography = ? WHERE AuthorID = ?", author.Name, author.Biography, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	h.Search.PutAuthor(id, author.Name, author.Biography)
 	c.JSON(http.StatusOK, gin.H{"message": "Author updated"})
 }
 
@@ -139,14 +191,82 @@ func (h *AuthorHandler) UpdateAuthor(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "Author ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /authors/{id} [delete]
 func (h *AuthorHandler) DeleteAuthor(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	_, err := h.DB.Exec("DELETE FROM Authors WHERE AuthorID = ?", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	h.Search.DeleteAuthor(id)
 	c.JSON(http.StatusOK, gin.H{"message": "Author deleted"})
 }
+
+// GetAuthorBooks godoc
+// @Summary Get books of an author
+// @Description Get a page of the books crediting an author given their ID in any role, or only in the given role, with all of their contributors
+// @Tags authors
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Author ID"
+// @Param role query string false "Role of the author" Enums(author, editor, translator, illustrator)
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, title, available_copies, publication_year, call_number" default(id)
+// @Success 200 {object} models.Page[models.Book]
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /authors/{id}/books [get]
+func (h *AuthorHandler) GetAuthorBooks(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	q := newListQuery(c, bookSortFields, "id")
+	if role := c.Query("role"); role == "" {
+		q.filter(bookAuthorFilter, id)
+	} else if validContributorRole(role) {
+		q.filter("BookID IN (SELECT BookID FROM BookAuthors WHERE AuthorID = ? AND Role = ?)", id, role)
+	} else {
+		q.fail(fmt.Errorf("Unknown role %s", role))
+	}
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Authors WHERE AuthorID = ?)", id).Scan(&exists); err != nil {
+		writeError(c, err)
+		return
+	}
+	if !exists {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Author not found")
+		return
+	}
+
+	total, rows, err := q.query(h.DB, bookColumns, "BookAvailability")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	books := []models.Book{}
+	for rows.Next() {
+		var book models.Book
+		if err := scanBook(rows, &book); err != nil {
+			writeError(c, err)
+			return
+		}
+		books = append(books, book)
+	}
+	if err := loadBookLinks(h.DB, books); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newPage(q, books, total))
+}
@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"books_rent/isbn"
 	"books_rent/models"
+	"books_rent/search"
 	"database/sql"
 	"errors"
 	"github.com/gin-gonic/gin"
@@ -10,125 +12,412 @@ import (
 )
 
 type BookHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Search *search.Index
 }
 
-func NewBookHandler(db *sql.DB) *BookHandler {
-	return &BookHandler{DB: db}
+func NewBookHandler(db *sql.DB, index *search.Index) *BookHandler {
+	return &BookHandler{DB: db, Search: index}
+}
+
+// bookColumns lists the BookAvailability columns in the order expected by
+// scanBook.
+const bookColumns = "BookID, Title, ISBN13, AuthorID, PublisherID, CategoryID, " +
+	"WorkID, PublicationYear, Language, ClassificationScheme, Classification, CallNumber, TotalCopies, AvailableCopies"
+
+// bookAuthorFilter keeps the books crediting an author in any role.
+const bookAuthorFilter = "BookID IN (SELECT BookID FROM BookAuthors WHERE AuthorID = ?)"
+
+// bookCategoryFilter keeps the books filed under a category.
+const bookCategoryFilter = "BookID IN (SELECT BookID FROM BookCategories WHERE CategoryID = ?)"
+
+// bookSortFields are the fields books can be sorted by. Sorting by call number
+// puts the books in shelf order, scheme by scheme, with the unclassified ones
+// last.
+var bookSortFields = map[string]string{
+	"id":               "BookID",
+	"title":            "Title",
+	"available_copies": "AvailableCopies",
+	"publication_year": "PublicationYear",
+	"call_number":      "CallNumberSort IS NULL, CallNumberSort",
+}
+
+// scanBook reads a row selected with bookColumns. A book is available when at
+// least one of its copies is. The contributors and subjects are loaded
+// separately, with loadBookLinks.
+func scanBook(row rowScanner, book *models.Book) error {
+	var isbn13, language, scheme, classification, callNumber sql.NullString
+	var authorID, publisherID, categoryID, workID, year sql.NullInt64
+	if err := row.Scan(&book.BookID, &book.Title, &isbn13, &authorID, &publisherID, &categoryID, &workID, &year, &language,
+		&scheme, &classification, &callNumber, &book.TotalCopies, &book.AvailableCopies); err != nil {
+		return err
+	}
+	book.ISBN13 = isbn13.String
+	book.WorkID = int(workID.Int64)
+	book.PublicationYear = int(year.Int64)
+	book.Language = language.String
+	book.ClassificationScheme = scheme.String
+	book.Classification = classification.String
+	book.CallNumber = callNumber.String
+	book.AuthorID = int(authorID.Int64)
+	book.PublisherID = int(publisherID.Int64)
+	book.CategoryID = int(categoryID.Int64)
+	book.ISBN10, _ = isbn.To10(book.ISBN13)
+	book.Available = book.AvailableCopies > 0
+	return nil
+}
+
+var (
+	errISBNMismatch = errors.New("isbn_10 and isbn_13 are different books")
+	errISBNTaken    = errors.New("A book with this ISBN already exists")
+)
+
+// normalizeISBN validates the ISBNs sent for a book, in either form or both,
+// and fills in both forms. A book without an ISBN is left without one.
+func normalizeISBN(book *models.Book) error {
+	var isbn13 string
+	for _, value := range []string{book.ISBN13, book.ISBN10} {
+		if value == "" {
+			continue
+		}
+		parsed, err := isbn.Parse(value)
+		if err != nil {
+			return err
+		}
+		if isbn13 != "" && parsed != isbn13 {
+			return errISBNMismatch
+		}
+		isbn13 = parsed
+	}
+	book.ISBN13 = isbn13
+	book.ISBN10, _ = isbn.To10(isbn13)
+	return nil
+}
+
+// checkISBNUnique returns errISBNTaken when a book other than bookID already
+// has the given ISBN-13.
+func checkISBNUnique(db *sql.DB, isbn13 string, bookID int) error {
+	if isbn13 == "" {
+		return nil
+	}
+	var taken bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM Books WHERE ISBN13 = ? AND BookID <> ?)", isbn13, bookID).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return errISBNTaken
+	}
+	return nil
+}
+
+// isbnValue prepares an ISBN-13 for the ISBN13 column, mapping no ISBN to NULL.
+func isbnValue(isbn13 string) interface{} {
+	if isbn13 == "" {
+		return nil
+	}
+	return isbn13
+}
+
+// writeISBNError responds to a failed normalizeISBN or checkISBNUnique call.
+func writeISBNError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errISBNTaken):
+		writeProblem(c, http.StatusConflict, ProblemCodeDuplicate, err.Error())
+	case errors.Is(err, errISBNMismatch), errors.Is(err, isbn.ErrLength), errors.Is(err, isbn.ErrChecksum):
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+	default:
+		writeError(c, err)
+	}
 }
 
 // GetBooks godoc
 // @Summary Get a list of books
-// @Description Get a list of all books
+// @Description Get a page of books with their contributors, subjects and the number of their copies and of those available, optionally filtered by author in any role, publisher, category, availability, work, language, classification scheme or a fragment of the title. Sorting by call_number gives the shelf order, for shelf-reading lists
 // @Tags books
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Book
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, title, available_copies, publication_year, call_number" default(id)
+// @Param author_id query int false "Author ID, in any role"
+// @Param publisher_id query int false "Publisher ID"
+// @Param category_id query int false "Category ID, among the subjects"
+// @Param available query bool false "true for books with an available copy"
+// @Param work_id query int false "Work ID, for the editions of a work"
+// @Param language query string false "MARC language code of the edition, such as pol or eng"
+// @Param classification_scheme query string false "Classification scheme: udc or ddc"
+// @Param title query string false "Fragment of the title"
+// @Success 200 {object} models.Page[models.Book]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /books [get]
 func (h *BookHandler) GetBooks(c *gin.Context) {
-	var books []models.Book
-	rows, err := h.DB.Query("SELECT * FROM Books")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	q := newListQuery(c, bookSortFields, "id")
+	q.filterIntWhere("author_id", bookAuthorFilter)
+	q.filterInt("publisher_id", "PublisherID")
+	q.filterIntWhere("category_id", bookCategoryFilter)
+	q.filterBool("available", "(AvailableCopies > 0)")
+	q.filterInt("work_id", "WorkID")
+	q.filterString("language", "Language")
+	q.filterString("classification_scheme", "ClassificationScheme")
+	q.filterContains("title", "Title")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
 		return
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var book models.Book
-		if err := rows.Scan(&book.BookID, &book.Title, &book.AuthorID, &book.PublisherID, &book.CategoryID, &book.Available); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		books = append(books, book)
-	}
-	c.JSON(http.StatusOK, books)
+	h.writeBooks(c, q, "BookAvailability")
 }
 
 // CreateBook godoc
 // @Summary Create a new book
-// @Description Add a new book to the database
+// @Description Add a new book to the database. The book has no copies until they are added with POST /copies. The ISBN may be given as isbn_10 or isbn_13, with or without hyphens, and must not belong to another book. Contributors are listed in order, each an existing author with the role author, editor, translator or illustrator; a book sent with only author_id gets that author as its sole contributor. Subjects are existing categories, the first being the main one; a book sent with only category_id is filed under that category alone. A classification is a UKD number with classification_scheme udc, or a Dewey number with ddc, checked against the scheme's syntax; the call number is generated from it, the main author's surname and the title, and any call_number sent is ignored. A book is an edition of the work given by work_id, if any, which must exist; language is a MARC language code such as pol or eng, and the translators are contributors with the translator role.
 // @Tags books
 // @Accept  json
 // @Produce  json
 // @Param book body models.Book true "Create Book"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /books [post]
 func (h *BookHandler) CreateBook(c *gin.Context) {
 	var book models.Book
-	if err := c.BindJSON(&book); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&book); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := normalizeISBN(&book); err != nil {
+		writeISBNError(c, err)
+		return
+	}
+	if err := checkISBNUnique(h.DB, book.ISBN13, 0); err != nil {
+		writeISBNError(c, err)
+		return
+	}
+	if err := normalizeContributors(&book); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	if err := normalizeSubjects(&book); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	if err := checkEdition(h.DB, &book); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	sortKey, err := classifyBook(h.DB, &book)
+	if err != nil {
+		writeClassificationError(c, err)
 		return
 	}
 
-	stmt, err := h.DB.Prepare("INSERT INTO Books (Title, AuthorID, PublisherID, CategoryID, Available) VALUES (?, ?, ?, ?, ?)")
+	tx, err := h.DB.Begin()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	_, err = stmt.Exec(book.Title, book.AuthorID, book.PublisherID, book.CategoryID, book.Available)
+	result, err := tx.Exec(`INSERT INTO Books (Title, ISBN13, PublisherID, WorkID, PublicationYear, Language,
+		ClassificationScheme, Classification, CallNumber, CallNumberSort) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		book.Title, isbnValue(book.ISBN13), nullID(book.PublisherID),
+		nullID(book.WorkID), nullInt(book.PublicationYear), nullString(book.Language),
+		nullString(book.ClassificationScheme), nullString(book.Classification), nullString(book.CallNumber), sortKey)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	id, err := result.LastInsertId()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	if err := saveContributors(tx, int(id), book.Contributors); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	if err := saveSubjects(tx, int(id), book.Subjects); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	h.Search.PutBook(int(id), book.Title, contributorIDs(book.Contributors), subjectIDs(book.Subjects))
 	c.JSON(http.StatusCreated, gin.H{"message": "Book created"})
 }
 
 // GetBookByID godoc
 // @Summary Get details of a specific book
-// @Description Get details of a book given its ID
+// @Description Get details of a book given its ID, with its contributors and subjects, each of its copies and the number of copies available
 // @Tags books
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Book ID"
 // @Success 200 {object} models.Book
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /books/{id} [get]
 func (h *BookHandler) GetBookByID(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	var book models.Book
-	err := h.DB.QueryRow("SELECT * FROM Books WHERE BookID = ?", id).Scan(&book.BookID, &book.Title, &book.AuthorID, &book.PublisherID, &book.CategoryID, &book.Available)
+	h.writeBook(c, h.DB.QueryRow("SELECT "+bookColumns+" FROM BookAvailability WHERE BookID = ?", id))
+}
+
+// GetBookByISBN godoc
+// @Summary Find a book by its ISBN
+// @Description Get details of the book with the given ISBN-10 or ISBN-13, written with or without hyphens, with its contributors and subjects, each of its copies and the number of copies available
+// @Tags books
+// @Accept  json
+// @Produce  json
+// @Param isbn path string true "ISBN-10 or ISBN-13"
+// @Success 200 {object} models.Book
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /books/isbn/{isbn} [get]
+func (h *BookHandler) GetBookByISBN(c *gin.Context) {
+	isbn13, err := isbn.Parse(c.Param("isbn"))
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+		return
+	}
+	h.writeBook(c, h.DB.QueryRow("SELECT "+bookColumns+" FROM BookAvailability WHERE ISBN13 = ?", isbn13))
+}
+
+// writeBook responds with the book selected with bookColumns, its
+// contributors, subjects and copies.
+func (h *BookHandler) writeBook(c *gin.Context, row *sql.Row) {
+	books := make([]models.Book, 1)
+	err := scanBook(row, &books[0])
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Book not found"})
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Book not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 		}
 		return
 	}
+	if err := loadBookLinks(h.DB, books); err != nil {
+		writeError(c, err)
+		return
+	}
+	book := books[0]
+
+	rows, err := h.DB.Query("SELECT "+copyColumns+" FROM Copies WHERE BookID = ? ORDER BY CopyID", book.BookID)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	book.Copies = []models.Copy{}
+	for rows.Next() {
+		var item models.Copy
+		if err := scanCopy(rows, &item); err != nil {
+			writeError(c, err)
+			return
+		}
+		book.Copies = append(book.Copies, item)
+	}
 	c.JSON(http.StatusOK, book)
 }
 
 // UpdateBook godoc
 // @Summary Update a book
-// @Description Update details of a book given its ID
+// @Description Update details of a book given its ID. The ISBN may be given as isbn_10 or isbn_13, with or without hyphens, and must not belong to another book. The contributors, subjects and classification sent replace those of the book, as on create, and the call number is generated again.
 // @Tags books
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Book ID"
 // @Param book body models.Book true "Update Book"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /books/{id} [put]
 func (h *BookHandler) UpdateBook(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var book models.Book
-	if err := c.BindJSON(&book); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&book); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Books WHERE BookID = ?)", id).Scan(&exists); err != nil {
+		writeError(c, err)
+		return
+	}
+	if !exists {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Book not found")
+		return
+	}
+	if err := normalizeISBN(&book); err != nil {
+		writeISBNError(c, err)
 		return
 	}
+	if err := checkISBNUnique(h.DB, book.ISBN13, id); err != nil {
+		writeISBNError(c, err)
+		return
+	}
+	if err := normalizeContributors(&book); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	if err := normalizeSubjects(&book); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	if err := checkEdition(h.DB, &book); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	sortKey, err := classifyBook(h.DB, &book)
+	if err != nil {
+		writeClassificationError(c, err)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
 
-	_, err := h.DB.Exec("UPDATE Books SET Title = ?, AuthorID = ?, PublisherID = ?, CategoryID = ?, Available = ? WHERE BookID = ?", book.Title, book.AuthorID, book.PublisherID, book.CategoryID, book.Available, id)
+	_, err = tx.Exec(`UPDATE Books SET Title = ?, ISBN13 = ?, PublisherID = ?, WorkID = ?, PublicationYear = ?, Language = ?,
+		ClassificationScheme = ?, Classification = ?, CallNumber = ?, CallNumberSort = ? WHERE BookID = ?`,
+		book.Title, isbnValue(book.ISBN13), nullID(book.PublisherID),
+		nullID(book.WorkID), nullInt(book.PublicationYear), nullString(book.Language),
+		nullString(book.ClassificationScheme), nullString(book.Classification), nullString(book.CallNumber), sortKey, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	if err := saveContributors(tx, id, book.Contributors); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	if err := saveSubjects(tx, id, book.Subjects); err != nil {
+		writeBookLinkError(c, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	h.Search.PutBook(id, book.Title, contributorIDs(book.Contributors), subjectIDs(book.Subjects))
 	c.JSON(http.StatusOK, gin.H{"message": "Book updated"})
 }
 
@@ -140,72 +429,116 @@ func (h *BookHandler) UpdateBook(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "Book ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /books/{id} [delete]
 func (h *BookHandler) DeleteBook(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	_, err := h.DB.Exec("DELETE FROM Books WHERE BookID = ?", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	h.Search.DeleteBook(id)
 	c.JSON(http.StatusOK, gin.H{"message": "Book deleted"})
 }
 
 // GetAvailableBooks godoc
 // @Summary Get available books
-// @Description Get a list of all books that are available
+// @Description Get a page of the books with at least one copy available, optionally filtered by author in any role, publisher, category or a fragment of the title
 // @Tags books
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Book
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, title, available_copies, publication_year, call_number" default(id)
+// @Param author_id query int false "Author ID, in any role"
+// @Param publisher_id query int false "Publisher ID"
+// @Param category_id query int false "Category ID, among the subjects"
+// @Param title query string false "Fragment of the title"
+// @Success 200 {object} models.Page[models.Book]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /books/available [get]
 func (h *BookHandler) GetAvailableBooks(c *gin.Context) {
-	var books []models.Book
-	rows, err := h.DB.Query("SELECT * FROM AvailableBooks")
+	q := newListQuery(c, bookSortFields, "id")
+	q.filterIntWhere("author_id", bookAuthorFilter)
+	q.filterInt("publisher_id", "PublisherID")
+	q.filterIntWhere("category_id", bookCategoryFilter)
+	q.filterContains("title", "Title")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	h.writeBooks(c, q, "AvailableBooks")
+}
+
+// writeBooks responds with the page of books from the BookAvailability view or
+// one built on it selected by q.
+func (h *BookHandler) writeBooks(c *gin.Context, q *listQuery, from string) {
+	total, rows, err := q.query(h.DB, bookColumns, from)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
+	books := []models.Book{}
 	for rows.Next() {
 		var book models.Book
-		if err := rows.Scan(&book.BookID, &book.Title, &book.AuthorID, &book.PublisherID, &book.CategoryID, &book.Available); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := scanBook(rows, &book); err != nil {
+			writeError(c, err)
 			return
 		}
 		books = append(books, book)
 	}
-	c.JSON(http.StatusOK, books)
+	if err := loadBookLinks(h.DB, books); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newPage(q, books, total))
 }
 
 // GetTopRatedBooks godoc
 // @Summary Get top-rated books
-// @Description Get a list of books with an average rating of 4 or higher
+// @Description Get a page of the books with an average rating of 4 or higher, best rated first by default
 // @Tags books
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Book
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, title, rating" default(-rating)
+// @Success 200 {object} models.Page[models.Book]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /books/top-rated [get]
 func (h *BookHandler) GetTopRatedBooks(c *gin.Context) {
-	var books []models.Book
-	rows, err := h.DB.Query("SELECT * FROM TopRatedBooks")
+	q := newListQuery(c, map[string]string{"id": "BookID", "title": "Title", "rating": "AverageRating"}, "-rating")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, "BookID, Title, AverageRating", "TopRatedBooks")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
+	books := []models.Book{}
 	for rows.Next() {
 		var book models.Book
 		var averageRating float64
 		if err := rows.Scan(&book.BookID, &book.Title, &averageRating); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 			return
 		}
 		book.AverageRating = averageRating
 		books = append(books, book)
 	}
-	c.JSON(http.StatusOK, books)
+	c.JSON(http.StatusOK, newPage(q, books, total))
 }
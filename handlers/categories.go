@@ -2,78 +2,208 @@ package handlers
 
 import (
 	"books_rent/models"
+	"books_rent/search"
 	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 type CategoryHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Search *search.Index
 }
 
-func NewCategoryHandler(db *sql.DB) *CategoryHandler {
-	return &CategoryHandler{DB: db}
+func NewCategoryHandler(db *sql.DB, index *search.Index) *CategoryHandler {
+	return &CategoryHandler{DB: db, Search: index}
+}
+
+// categoryColumns lists the Categories columns in the order expected by
+// scanCategory.
+const categoryColumns = "CategoryID, Name, Description, ParentID"
+
+var errCategoryCycle = errors.New("A category cannot be placed under itself or one of its subcategories")
+
+func scanCategory(row rowScanner, category *models.Category) error {
+	var name, description sql.NullString
+	var parentID sql.NullInt64
+	if err := row.Scan(&category.CategoryID, &name, &description, &parentID); err != nil {
+		return err
+	}
+	category.Name = name.String
+	category.Description = description.String
+	category.ParentID = nil
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		category.ParentID = &id
+	}
+	return nil
+}
+
+// loadCategoryParents maps every category to its parent, 0 for a top-level
+// category.
+func loadCategoryParents(db *sql.DB) (map[int]int, error) {
+	rows, err := db.Query("SELECT CategoryID, ParentID FROM Categories")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	parents := map[int]int{}
+	for rows.Next() {
+		var id int
+		var parentID sql.NullInt64
+		if err := rows.Scan(&id, &parentID); err != nil {
+			return nil, err
+		}
+		parents[id] = int(parentID.Int64)
+	}
+	return parents, rows.Err()
+}
+
+// descendants returns the category followed by every category below it.
+func descendants(parents map[int]int, id int) []int {
+	children := map[int][]int{}
+	for child, parent := range parents {
+		children[parent] = append(children[parent], child)
+	}
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// checkParent validates the parent of a category, which must exist and must
+// not be the category itself or one of its subcategories. id is 0 for a new
+// category.
+func checkParent(db *sql.DB, id int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	parents, err := loadCategoryParents(db)
+	if err != nil {
+		return err
+	}
+	if _, ok := parents[*parentID]; !ok {
+		return fmt.Errorf("%w %d", errUnknownCategory, *parentID)
+	}
+	// The walk up from the parent reaches a top-level category within
+	// len(parents) steps unless the categories already form a cycle.
+	ancestor := *parentID
+	for steps := 0; ancestor != 0 && steps <= len(parents); steps++ {
+		if ancestor == id {
+			return errCategoryCycle
+		}
+		ancestor = parents[ancestor]
+	}
+	return nil
+}
+
+// writeParentError responds to a failed checkParent call.
+func writeParentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUnknownCategory):
+		writeProblem(c, http.StatusUnprocessableEntity, ProblemCodeUnknownReference, err.Error())
+		return
+	case errors.Is(err, errCategoryCycle):
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+		return
+	}
+	writeError(c, err)
 }
 
 // GetCategories godoc
 // @Summary Get a list of categories
-// @Description Get a list of all categories
+// @Description Get a page of categories, optionally filtered by parent category or a fragment of the name
 // @Tags categories
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Category
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, name" default(id)
+// @Param parent_id query int false "Parent category ID"
+// @Param top_level query bool false "true for categories without a parent, false for subcategories"
+// @Param name query string false "Fragment of the name"
+// @Success 200 {object} models.Page[models.Category]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /categories [get]
 func (h *CategoryHandler) GetCategories(c *gin.Context) {
-	var categories []models.Category
-	rows, err := h.DB.Query("SELECT * FROM Categories")
+	q := newListQuery(c, map[string]string{"id": "CategoryID", "name": "Name"}, "id")
+	q.filterInt("parent_id", "ParentID")
+	q.filterNull("top_level", "ParentID")
+	q.filterContains("name", "Name")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, categoryColumns, "Categories")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
+	categories := []models.Category{}
 	for rows.Next() {
 		var category models.Category
-		if err := rows.Scan(&category.CategoryID, &category.Name, &category.Description); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := scanCategory(rows, &category); err != nil {
+			writeError(c, err)
 			return
 		}
 		categories = append(categories, category)
 	}
-	c.JSON(http.StatusOK, categories)
+	c.JSON(http.StatusOK, newPage(q, categories, total))
 }
 
 // CreateCategory godoc
 // @Summary Create a new category
-// @Description Add a new category to the database
+// @Description Add a new category to the database, optionally as a subcategory of the category given by parent_id
 // @Tags categories
 // @Accept  json
 // @Produce  json
 // @Param category body models.Category true "Create Category"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /categories [post]
 func (h *CategoryHandler) CreateCategory(c *gin.Context) {
 	var category models.Category
-	if err := c.BindJSON(&category); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&category); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if err := checkParent(h.DB, 0, category.ParentID); err != nil {
+		writeParentError(c, err)
 		return
 	}
 
-	stmt, err := h.DB.Prepare("INSERT INTO Categories (Name, Description) VALUES (?, ?)")
+	stmt, err := h.DB.Prepare("INSERT INTO Categories (Name, Description, ParentID) VALUES (?, ?, ?)")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(category.Name, category.Description)
+	result, err := stmt.Exec(category.Name, category.Description, category.ParentID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	h.Search.PutCategory(int(id), category.Name)
 	c.JSON(http.StatusCreated, gin.H{"message": "Category created"})
 }
 
@@ -85,18 +215,19 @@ func (h *CategoryHandler) CreateCategory(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "Category ID"
 // @Success 200 {object} models.Category
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /categories/{id} [get]
 func (h *CategoryHandler) GetCategoryByID(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var category models.Category
-	err := h.DB.QueryRow("SELECT * FROM Categories WHERE CategoryID = ?", id).Scan(&category.CategoryID, &category.Name, &category.Description)
+	err := scanCategory(h.DB.QueryRow("SELECT "+categoryColumns+" FROM Categories WHERE CategoryID = ?", id), &category)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Category not found"})
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Category not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 		}
 		return
 	}
@@ -105,48 +236,213 @@ func (h *CategoryHandler) GetCategoryByID(c *gin.Context) {
 
 // UpdateCategory godoc
 // @Summary Update a category
-// @Description Update details of a category given its ID
+// @Description Update details of a category given its ID. The category can be moved under another parent, but not under itself or one of its subcategories.
 // @Tags categories
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Category ID"
 // @Param category body models.Category true "Update Category"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /categories/{id} [put]
 func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var category models.Category
-	if err := c.BindJSON(&category); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&category); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Categories WHERE CategoryID = ?)", id).Scan(&exists); err != nil {
+		writeError(c, err)
+		return
+	}
+	if !exists {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Category not found")
+		return
+	}
+	if err := checkParent(h.DB, id, category.ParentID); err != nil {
+		writeParentError(c, err)
 		return
 	}
 
-	_, err := h.DB.Exec("UPDATE Categories SET Name = ?, Description = ? WHERE CategoryID = ?", category.Name, category.Description, id)
+	_, err := h.DB.Exec("UPDATE Categories SET Name = ?, Description = ?, ParentID = ? WHERE CategoryID = ?", category.Name, category.Description, category.ParentID, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	h.Search.PutCategory(id, category.Name)
 	c.JSON(http.StatusOK, gin.H{"message": "Category updated"})
 }
 
 // DeleteCategory godoc
 // @Summary Delete a category
-// @Description Delete a category given its ID
+// @Description Delete a category given its ID. A category that still has subcategories or books filed under it cannot be deleted.
 // @Tags categories
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Category ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /categories/{id} [delete]
 func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	_, err := h.DB.Exec("DELETE FROM Categories WHERE CategoryID = ?", id)
+	var children, books int
+	err := h.DB.QueryRow(`SELECT (SELECT COUNT(*) FROM Categories WHERE ParentID = ?),
+		(SELECT COUNT(*) FROM BookCategories WHERE CategoryID = ?)`, id, id).Scan(&children, &books)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if children > 0 {
+		writeProblem(c, http.StatusConflict, ProblemCodeStillReferenced, fmt.Sprintf("Category has %d subcategories; move or delete them first", children))
+		return
+	}
+	if books > 0 {
+		writeProblem(c, http.StatusConflict, ProblemCodeStillReferenced, fmt.Sprintf("Category has %d books filed under it; refile them first", books))
+		return
+	}
+
+	_, err = h.DB.Exec("DELETE FROM Categories WHERE CategoryID = ?", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	h.Search.DeleteCategory(id)
 	c.JSON(http.StatusOK, gin.H{"message": "Category deleted"})
 }
+
+// GetCategoryTree godoc
+// @Summary Get the category tree
+// @Description Get every category, nested under its parent, with the top-level categories and the subcategories of each category sorted by name
+// @Tags categories
+// @Accept  json
+// @Produce  json
+// @Success 200 {array} models.Category
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /categories/tree [get]
+func (h *CategoryHandler) GetCategoryTree(c *gin.Context) {
+	rows, err := h.DB.Query("SELECT " + categoryColumns + " FROM Categories ORDER BY Name, CategoryID")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var category models.Category
+		if err := scanCategory(rows, &category); err != nil {
+			writeError(c, err)
+			return
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	children := map[int][]models.Category{}
+	for _, category := range categories {
+		parentID := 0
+		if category.ParentID != nil {
+			parentID = *category.ParentID
+		}
+		children[parentID] = append(children[parentID], category)
+	}
+	c.JSON(http.StatusOK, categoryTree(children, 0))
+}
+
+// categoryTree returns the categories under parentID with their subcategories
+// nested in them.
+func categoryTree(children map[int][]models.Category, parentID int) []models.Category {
+	tree := []models.Category{}
+	for _, category := range children[parentID] {
+		category.Children = categoryTree(children, category.CategoryID)
+		tree = append(tree, category)
+	}
+	return tree
+}
+
+// GetCategoryBooks godoc
+// @Summary Get books of a category
+// @Description Get a page of the books filed under a category given its ID, with include_descendants=true also those filed under any of its subcategories at any depth
+// @Tags categories
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Category ID"
+// @Param include_descendants query bool false "Include books of the subcategories" default(false)
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, title, available_copies, publication_year, call_number" default(id)
+// @Success 200 {object} models.Page[models.Book]
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /categories/{id}/books [get]
+func (h *CategoryHandler) GetCategoryBooks(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	q := newListQuery(c, bookSortFields, "id")
+	includeDescendants, err := strconv.ParseBool(c.DefaultQuery("include_descendants", "false"))
+	if err != nil {
+		q.fail(errors.New("include_descendants must be true or false"))
+	}
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	parents, err := loadCategoryParents(h.DB)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if _, ok := parents[id]; !ok {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Category not found")
+		return
+	}
+
+	ids := []int{id}
+	if includeDescendants {
+		ids = descendants(parents, id)
+	}
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, categoryID := range ids {
+		placeholders[i] = "?"
+		args[i] = categoryID
+	}
+	q.filter("BookID IN (SELECT BookID FROM BookCategories WHERE CategoryID IN ("+strings.Join(placeholders, ", ")+"))", args...)
+
+	total, rows, err := q.query(h.DB, bookColumns, "BookAvailability")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	books := []models.Book{}
+	for rows.Next() {
+		var book models.Book
+		if err := scanBook(rows, &book); err != nil {
+			writeError(c, err)
+			return
+		}
+		books = append(books, book)
+	}
+	if err := loadBookLinks(h.DB, books); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newPage(q, books, total))
+}
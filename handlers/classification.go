@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"books_rent/classification"
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// classifyBook validates the classification sent for a book, which must come
+// after normalizeContributors, and generates its call number from the
+// classification, the main author and the title. It returns the sort key of
+// the call number for the CallNumberSort column, or nil for a book without a
+// classification.
+func classifyBook(db *sql.DB, book *models.Book) (interface{}, error) {
+	book.CallNumber = ""
+	if book.Classification == "" {
+		book.ClassificationScheme = ""
+		return nil, nil
+	}
+	number, err := classification.Parse(book.ClassificationScheme, book.Classification)
+	if err != nil {
+		return nil, err
+	}
+	var author sql.NullString
+	if book.AuthorID != 0 {
+		err := db.QueryRow("SELECT Name FROM Authors WHERE AuthorID = ?", book.AuthorID).Scan(&author)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+	}
+	book.Classification = number.Text
+	callNumber, sortKey := number.CallNumber(author.String, book.Title)
+	book.CallNumber = callNumber
+	return sortKey, nil
+}
+
+// nullString maps an empty string to NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// nullInt maps 0 to NULL.
+func nullInt(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+// writeClassificationError responds to a failed classifyBook call.
+func writeClassificationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, classification.ErrScheme), errors.Is(err, classification.ErrSyntax):
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+	default:
+		writeError(c, err)
+	}
+}
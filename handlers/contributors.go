@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+var (
+	errUnknownAuthor   = errors.New("Unknown author")
+	errBadContributors = errors.New("invalid contributors")
+)
+
+// validContributorRole reports whether role is one of the contributor roles.
+func validContributorRole(role string) bool {
+	switch role {
+	case models.ContributorAuthor, models.ContributorEditor, models.ContributorTranslator, models.ContributorIllustrator:
+		return true
+	}
+	return false
+}
+
+// normalizeContributors rejects contributors listed twice and defaults their
+// roles; IDs and roles are checked when the body is bound. A book sent with
+// only an author_id gets that author as its sole contributor.
+func normalizeContributors(book *models.Book) error {
+	if len(book.Contributors) == 0 && book.AuthorID != 0 {
+		book.Contributors = []models.Contributor{{AuthorID: book.AuthorID}}
+	}
+	seen := map[models.Contributor]bool{}
+	for i := range book.Contributors {
+		contributor := &book.Contributors[i]
+		contributor.Name = ""
+		if contributor.Role == "" {
+			contributor.Role = models.ContributorAuthor
+		}
+		if seen[*contributor] {
+			return fmt.Errorf("%w: author %d is listed twice as %s", errBadContributors, contributor.AuthorID, contributor.Role)
+		}
+		seen[*contributor] = true
+	}
+	book.AuthorID = mainAuthor(book.Contributors)
+	return nil
+}
+
+// mainAuthor returns the first contributor with the author role, or 0.
+func mainAuthor(contributors []models.Contributor) int {
+	for _, contributor := range contributors {
+		if contributor.Role == models.ContributorAuthor {
+			return contributor.AuthorID
+		}
+	}
+	return 0
+}
+
+// contributorIDs returns the distinct authors among the contributors, as the
+// search index links a book to each of them.
+func contributorIDs(contributors []models.Contributor) []int {
+	var ids []int
+	seen := map[int]bool{}
+	for _, contributor := range contributors {
+		if !seen[contributor.AuthorID] {
+			seen[contributor.AuthorID] = true
+			ids = append(ids, contributor.AuthorID)
+		}
+	}
+	return ids
+}
+
+// saveContributors replaces the contributors of a book, numbering them in
+// order. It returns errUnknownAuthor for an author not in the catalogue.
+func saveContributors(tx *sql.Tx, bookID int, contributors []models.Contributor) error {
+	if _, err := tx.Exec("DELETE FROM BookAuthors WHERE BookID = ?", bookID); err != nil {
+		return err
+	}
+	for i, contributor := range contributors {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM Authors WHERE AuthorID = ?)", contributor.AuthorID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w %d", errUnknownAuthor, contributor.AuthorID)
+		}
+		if _, err := tx.Exec("INSERT INTO BookAuthors (BookID, AuthorID, Role, Position) VALUES (?, ?, ?, ?)", bookID, contributor.AuthorID, contributor.Role, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeBookLinkError responds to a failed validation or save of a book's
+// contributors, subjects or edition details.
+func writeBookLinkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUnknownAuthor), errors.Is(err, errUnknownCategory), errors.Is(err, errUnknownWork):
+		writeProblem(c, http.StatusUnprocessableEntity, ProblemCodeUnknownReference, err.Error())
+	case errors.Is(err, errBadContributors), errors.Is(err, errBadSubjects):
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+	default:
+		writeError(c, err)
+	}
+}
+
+// bookSet prepares the IDs of books for an IN list, and maps each ID to the
+// positions of its books in the slice.
+func bookSet(books []models.Book) (placeholders string, args []interface{}, byID map[int][]int) {
+	list := make([]string, len(books))
+	args = make([]interface{}, len(books))
+	byID = map[int][]int{}
+	for i, book := range books {
+		list[i] = "?"
+		args[i] = book.BookID
+		byID[book.BookID] = append(byID[book.BookID], i)
+	}
+	return strings.Join(list, ", "), args, byID
+}
+
+// loadBookLinks fills in the contributors and subjects of the books.
+func loadBookLinks(db *sql.DB, books []models.Book) error {
+	if err := loadContributors(db, books); err != nil {
+		return err
+	}
+	return loadSubjects(db, books)
+}
+
+// loadContributors fills in the contributors of the books with one query.
+func loadContributors(db *sql.DB, books []models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+	for i := range books {
+		books[i].Contributors = []models.Contributor{}
+	}
+	placeholders, args, byID := bookSet(books)
+
+	rows, err := db.Query(`SELECT ba.BookID, ba.AuthorID, a.Name, ba.Role FROM BookAuthors ba
+		JOIN Authors a ON a.AuthorID = ba.AuthorID
+		WHERE ba.BookID IN (`+placeholders+`)
+		ORDER BY ba.BookID, ba.Position`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bookID int
+		var contributor models.Contributor
+		var name sql.NullString
+		if err := rows.Scan(&bookID, &contributor.AuthorID, &name, &contributor.Role); err != nil {
+			return err
+		}
+		contributor.Name = name.String
+		for _, i := range byID[bookID] {
+			books[i].Contributors = append(books[i].Contributors, contributor)
+		}
+	}
+	return rows.Err()
+}
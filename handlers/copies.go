@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type CopyHandler struct {
+	DB     *sql.DB
+	Policy Policy
+}
+
+func NewCopyHandler(db *sql.DB, policy Policy) *CopyHandler {
+	return &CopyHandler{DB: db, Policy: policy}
+}
+
+// copyColumns lists the Copies columns in the order expected by scanCopy.
+const copyColumns = "CopyID, BookID, Barcode, ShelfLocation, CopyCondition, Status"
+
+func scanCopy(row rowScanner, item *models.Copy) error {
+	var shelfLocation sql.NullString
+	if err := row.Scan(&item.CopyID, &item.BookID, &item.Barcode, &shelfLocation, &item.Condition, &item.Status); err != nil {
+		return err
+	}
+	item.ShelfLocation = shelfLocation.String
+	return nil
+}
+
+// shelfStatus reports whether a librarian may set a copy to status. Copies
+// only go on loan or on hold through checkouts, returns and reservations.
+func shelfStatus(status string) bool {
+	switch status {
+	case models.CopyAvailable, models.CopyInRepair, models.CopyLost, models.CopyWithdrawn:
+		return true
+	}
+	return false
+}
+
+// GetCopies godoc
+// @Summary Get a list of copies
+// @Description Get a page of physical copies, optionally filtered by book, status, condition or a fragment of the shelf location
+// @Tags copies
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, barcode, shelf_location, status" default(id)
+// @Param book_id query int false "Book ID"
+// @Param status query string false "Status" Enums(available, on_loan, on_hold, in_repair, lost, withdrawn)
+// @Param condition query string false "Condition" Enums(new, good, fair, poor, damaged)
+// @Param shelf_location query string false "Fragment of the shelf location"
+// @Success 200 {object} models.Page[models.Copy]
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /copies [get]
+func (h *CopyHandler) GetCopies(c *gin.Context) {
+	q := newListQuery(c, map[string]string{"id": "CopyID", "barcode": "Barcode", "shelf_location": "ShelfLocation", "status": "Status"}, "id")
+	q.filterInt("book_id", "BookID")
+	q.filterString("status", "Status")
+	q.filterString("condition", "CopyCondition")
+	q.filterContains("shelf_location", "ShelfLocation")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, copyColumns, "Copies")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	copies := []models.Copy{}
+	for rows.Next() {
+		var item models.Copy
+		if err := scanCopy(rows, &item); err != nil {
+			writeError(c, err)
+			return
+		}
+		copies = append(copies, item)
+	}
+	c.JSON(http.StatusOK, newPage(q, copies, total))
+}
+
+// CreateCopy godoc
+// @Summary Add a copy of a book
+// @Description Register a new physical copy of a book. The condition defaults to good and the status to available. An available copy is first offered to the book's reservation queue and is held for the next patron in line if anyone is waiting.
+// @Tags copies
+// @Accept  json
+// @Produce  json
+// @Param copy body models.Copy true "Create Copy"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /copies [post]
+func (h *CopyHandler) CreateCopy(c *gin.Context) {
+	var item models.Copy
+	if err := c.ShouldBindJSON(&item); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if item.Condition == "" {
+		item.Condition = models.ConditionGood
+	}
+	if item.Status == "" {
+		item.Status = models.CopyAvailable
+	}
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := tx.QueryRow("SELECT BookID FROM Books WHERE BookID = ? FOR UPDATE", item.BookID).Scan(&item.BookID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Book not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO Copies (BookID, Barcode, ShelfLocation, CopyCondition, Status) VALUES (?, ?, ?, ?, ?)", item.BookID, item.Barcode, item.ShelfLocation, item.Condition, item.Status)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	copyID, err := result.LastInsertId()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	var reservationID *int
+	if item.Status == models.CopyAvailable {
+		reservationID, err = promoteNextReservation(tx, h.Policy, item.BookID, int(copyID))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	response := gin.H{"message": "Copy created", "copy_id": copyID}
+	if reservationID != nil {
+		response["reservation_id"] = *reservationID
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetCopyByID godoc
+// @Summary Get details of a specific copy
+// @Description Get details of a physical copy given its ID
+// @Tags copies
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Copy ID"
+// @Success 200 {object} models.Copy
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /copies/{id} [get]
+func (h *CopyHandler) GetCopyByID(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	h.writeCopy(c, h.DB.QueryRow("SELECT "+copyColumns+" FROM Copies WHERE CopyID = ?", id))
+}
+
+// GetCopyByBarcode godoc
+// @Summary Find a copy by its barcode
+// @Description Get details of the physical copy with the given barcode, as scanned at the desk
+// @Tags copies
+// @Accept  json
+// @Produce  json
+// @Param barcode path string true "Barcode"
+// @Success 200 {object} models.Copy
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /copies/barcode/{barcode} [get]
+func (h *CopyHandler) GetCopyByBarcode(c *gin.Context) {
+	h.writeCopy(c, h.DB.QueryRow("SELECT "+copyColumns+" FROM Copies WHERE Barcode = ?", c.Param("barcode")))
+}
+
+// writeCopy responds with the copy selected with copyColumns.
+func (h *CopyHandler) writeCopy(c *gin.Context, row *sql.Row) {
+	var item models.Copy
+	if err := scanCopy(row, &item); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Copy not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// UpdateCopy godoc
+// @Summary Update a copy
+// @Description Update the barcode, shelf location, condition or status of a copy given its ID. The status can be set to available, in_repair, lost or withdrawn, but not while the copy is on loan or held for pickup; an empty status leaves it unchanged. A copy put back on the shelf is first offered to the book's reservation queue.
+// @Tags copies
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Copy ID"
+// @Param copy body models.Copy true "Update Copy"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /copies/{id} [put]
+func (h *CopyHandler) UpdateCopy(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var update models.Copy
+	if err := c.ShouldBindJSON(&update); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	if update.Condition == "" {
+		update.Condition = models.ConditionGood
+	}
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// The book row is locked before the copy, in the same order as
+	// checkouts and returns take their locks.
+	var item models.Copy
+	err = tx.QueryRow("SELECT BookID FROM Copies WHERE CopyID = ?", id).Scan(&item.BookID)
+	if err == nil {
+		err = tx.QueryRow("SELECT BookID FROM Books WHERE BookID = ? FOR UPDATE", item.BookID).Scan(&item.BookID)
+	}
+	if err == nil {
+		err = scanCopy(tx.QueryRow("SELECT "+copyColumns+" FROM Copies WHERE CopyID = ? FOR UPDATE", id), &item)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Copy not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+
+	if update.Status == "" {
+		update.Status = item.Status
+	}
+	if update.Status != item.Status && !shelfStatus(item.Status) {
+		writeProblem(c, http.StatusConflict, CopyCodeInCirculation, "Copy is on loan or held for pickup")
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE Copies SET Barcode = ?, ShelfLocation = ?, CopyCondition = ?, Status = ? WHERE CopyID = ?", update.Barcode, update.ShelfLocation, update.Condition, update.Status, id); err != nil {
+		writeError(c, err)
+		return
+	}
+	if update.Status == models.CopyAvailable && item.Status != models.CopyAvailable {
+		if _, err := promoteNextReservation(tx, h.Policy, item.BookID, id); err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Copy updated"})
+}
+
+// CopyCodeInCirculation is the code of the problem returned when a copy that
+// is on loan or held for pickup is deleted.
+const CopyCodeInCirculation = "copy_in_circulation"
+
+// DeleteCopy godoc
+// @Summary Delete a copy
+// @Description Delete a copy given its ID. Copies with loan history cannot be deleted and should be marked withdrawn instead.
+// @Tags copies
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Copy ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /copies/{id} [delete]
+func (h *CopyHandler) DeleteCopy(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	_, err := h.DB.Exec("DELETE FROM Copies WHERE CopyID = ?", id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Copy deleted"})
+}
@@ -0,0 +1,690 @@
+package handlers
+
+import (
+	"books_rent/classification"
+	"books_rent/isbn"
+	"books_rent/models"
+	"books_rent/search"
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// csvRow is a data row of an imported CSV file, read by column name.
+type csvRow struct {
+	line   int
+	values map[string]string
+}
+
+func (r csvRow) get(column string) string {
+	return strings.TrimSpace(r.values[column])
+}
+
+// csvItem is a validated row, ready to be saved.
+type csvItem interface {
+	insert(tx *sql.Tx) (int, error)
+	index(idx *search.Index, id int)
+}
+
+// csvResource describes how a resource is imported from and exported to CSV.
+// An exported file has the ID column first, followed by the columns accepted
+// on import; the ID column is ignored on import.
+type csvResource struct {
+	role     string // role needed to import
+	required []string
+	columns  []string
+	export   string
+	parse    func(v *csvValidator, row csvRow) csvItem
+}
+
+var csvResources = map[string]csvResource{
+	"books": {
+		role:     models.RoleLibrarian,
+		required: []string{"title"},
+		columns:  []string{"book_id", "title", "isbn", "author", "contributors", "publisher", "category", "subjects", "classification_scheme", "classification", "call_number"},
+		export: `SELECT b.BookID, b.Title, b.ISBN13, a.Name,
+			(SELECT GROUP_CONCAT(CONCAT(ca.Name, ' (', ba.Role, ')') ORDER BY ba.Position SEPARATOR '|')
+				FROM BookAuthors ba JOIN Authors ca ON ca.AuthorID = ba.AuthorID WHERE ba.BookID = b.BookID),
+			p.Name, c.Name,
+			(SELECT GROUP_CONCAT(sc.Name ORDER BY bc.Position SEPARATOR '|')
+				FROM BookCategories bc JOIN Categories sc ON sc.CategoryID = bc.CategoryID WHERE bc.BookID = b.BookID),
+			b.ClassificationScheme, b.Classification, b.CallNumber FROM BookAvailability b
+			LEFT JOIN Authors a ON a.AuthorID = b.AuthorID
+			LEFT JOIN Publishers p ON p.PublisherID = b.PublisherID
+			LEFT JOIN Categories c ON c.CategoryID = b.CategoryID
+			ORDER BY b.BookID`,
+		parse: parseBookCSV,
+	},
+	"authors": {
+		role:     models.RoleAdmin,
+		required: []string{"name"},
+		columns:  []string{"author_id", "name", "biography"},
+		export:   "SELECT AuthorID, Name, Biography FROM Authors ORDER BY AuthorID",
+		parse:    parseAuthorCSV,
+	},
+	"publishers": {
+		role:     models.RoleLibrarian,
+		required: []string{"name"},
+		columns:  []string{"publisher_id", "name", "address"},
+		export:   "SELECT PublisherID, Name, Address FROM Publishers ORDER BY PublisherID",
+		parse:    parsePublisherCSV,
+	},
+	"categories": {
+		role:     models.RoleAdmin,
+		required: []string{"name"},
+		columns:  []string{"category_id", "name", "description", "parent"},
+		export: `SELECT c.CategoryID, c.Name, c.Description, p.Name FROM Categories c
+			LEFT JOIN Categories p ON p.CategoryID = c.ParentID
+			ORDER BY c.CategoryID`,
+		parse: parseCategoryCSV,
+	},
+	"users": {
+		role:     models.RoleAdmin,
+		required: []string{"name", "email"},
+		columns:  []string{"user_id", "name", "email", "role", "status", "expiry_date"},
+		export:   "SELECT UserID, Name, Email, Role, Status, ExpiryDate FROM Users ORDER BY UserID",
+		parse:    parseUserCSV,
+	},
+}
+
+// csvComma guesses the separator from the header line: spreadsheets saved
+// with Polish regional settings separate fields with semicolons.
+func csvComma(data []byte) rune {
+	header, _, _ := bytes.Cut(data, []byte("\n"))
+	if bytes.Count(header, []byte(";")) > bytes.Count(header, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+// readCSV reads the header and the data rows of a CSV file. Column names are
+// matched ignoring case; rows with no values are skipped.
+func readCSV(data []byte, required []string) ([]csvRow, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = csvComma(data)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+	}
+	for _, column := range required {
+		if !slices.Contains(header, column) {
+			return nil, fmt.Errorf("missing column %s", column)
+		}
+	}
+
+	var rows []csvRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		row := csvRow{line: line, values: map[string]string{}}
+		blank := true
+		for i, value := range record {
+			if i < len(header) {
+				row.values[header[i]] = value
+			}
+			if strings.TrimSpace(value) != "" {
+				blank = false
+			}
+		}
+		if !blank {
+			rows = append(rows, row)
+		}
+	}
+}
+
+// csvValidator checks the rows of an import against the catalogue and against
+// the rows before them, collecting every error rather than stopping at the
+// first. A database error is kept in err and ends the import.
+type csvValidator struct {
+	db     *sql.DB
+	known  map[string]names
+	seen   map[string]map[string]int
+	errors []models.CSVRowError
+	err    error
+}
+
+func (h *ImportHandler) newCSVValidator() (*csvValidator, error) {
+	known, err := loadKnownNames(h.DB)
+	if err != nil {
+		return nil, err
+	}
+	return &csvValidator{db: h.DB, known: known, seen: map[string]map[string]int{}, errors: []models.CSVRowError{}}, nil
+}
+
+func (v *csvValidator) fail(row csvRow, column, message string) {
+	v.errors = append(v.errors, models.CSVRowError{Row: row.line, Column: column, Error: message})
+}
+
+// require returns the value of a column that must not be empty.
+func (v *csvValidator) require(row csvRow, column string) string {
+	value := row.get(column)
+	if value == "" {
+		v.fail(row, column, column+" is required")
+	}
+	return value
+}
+
+// validate checks a row against the binding rules of its model, recording an
+// error for every field that breaks one. The JSON names of the fields are the
+// names of the columns.
+func (v *csvValidator) validate(row csvRow, item interface{}) {
+	err := binding.Validator.ValidateStruct(item)
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) {
+		for _, fe := range invalid {
+			problem := fieldError(fe)
+			v.fail(row, problem.Field, problem.Message)
+		}
+	} else if err != nil && v.err == nil {
+		v.err = err
+	}
+}
+
+// unique reports whether key is the first of its column in the file, and
+// records an error for a repeated one.
+func (v *csvValidator) unique(row csvRow, column, key string) bool {
+	if v.seen[column] == nil {
+		v.seen[column] = map[string]int{}
+	}
+	if line, ok := v.seen[column][key]; ok {
+		v.fail(row, column, fmt.Sprintf("duplicates row %d", line))
+		return false
+	}
+	v.seen[column][key] = row.line
+	return true
+}
+
+// exists reports whether the query finds a row.
+func (v *csvValidator) exists(query string, args ...interface{}) bool {
+	var found bool
+	if err := v.db.QueryRow("SELECT EXISTS ("+query+")", args...).Scan(&found); err != nil && v.err == nil {
+		v.err = err
+	}
+	return found
+}
+
+// newName returns the name of an author, publisher or category to create,
+// which must not match one already in the catalogue or earlier in the file.
+func (v *csvValidator) newName(row csvRow, entryType string) string {
+	name := v.require(row, "name")
+	if name == "" {
+		return ""
+	}
+	key := nameKey(name)
+	if _, ok := v.known[entryType][key]; ok {
+		v.fail(row, "name", fmt.Sprintf("%s %s already exists", entryType, name))
+	} else {
+		v.unique(row, "name", key)
+	}
+	return name
+}
+
+// resolve returns the ID of the author, publisher or category named in the
+// column, or 0 when the column is empty.
+func (v *csvValidator) resolve(row csvRow, column, entryType string) int {
+	return v.resolveName(row, column, entryType, row.get(column))
+}
+
+// resolveName returns the ID of the author, publisher or category with the
+// given name, found in the column, or 0 when the name is empty.
+func (v *csvValidator) resolveName(row csvRow, column, entryType, name string) int {
+	if name == "" {
+		return 0
+	}
+	id, ok := v.known[entryType][nameKey(name)]
+	if !ok {
+		v.fail(row, column, fmt.Sprintf("unknown %s %s", entryType, name))
+	}
+	return id
+}
+
+// csvListSeparator separates the entries of the contributors and subjects
+// columns.
+const csvListSeparator = "|"
+
+// splitCSVList returns the non-empty entries of a list column.
+func splitCSVList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, csvListSeparator) {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parseCSVContributor splits an entry of the contributors column, such as
+// "Jan Kowalski (translator)", into a name and a role. An entry that does not
+// end with a known role in parentheses names an author.
+func parseCSVContributor(entry string) (name, role string) {
+	if open := strings.LastIndex(entry, "("); open > 0 && strings.HasSuffix(entry, ")") {
+		role = strings.TrimSpace(entry[open+1 : len(entry)-1])
+		if validContributorRole(role) {
+			return strings.TrimSpace(entry[:open]), role
+		}
+	}
+	return entry, models.ContributorAuthor
+}
+
+type bookCSV struct {
+	title                      string
+	isbn13                     string
+	publisherID                int
+	contributors               []models.Contributor
+	subjects                   []models.Subject
+	classification             classification.Number
+	callNumber, callNumberSort string
+}
+
+// bookContributors reads the contributors of a book and returns them with the
+// name of the main author. Without a contributors column the author column
+// names the sole author; with one, the author column, which an export fills
+// in as well, must name the first author among the contributors.
+func (v *csvValidator) bookContributors(row csvRow) ([]models.Contributor, string) {
+	author := row.get("author")
+	entries := splitCSVList(row.get("contributors"))
+	if len(entries) == 0 {
+		if id := v.resolve(row, "author", importAuthor); id != 0 {
+			return []models.Contributor{{AuthorID: id, Role: models.ContributorAuthor}}, author
+		}
+		return nil, author
+	}
+
+	var contributors []models.Contributor
+	var mainAuthor string
+	seen := map[models.Contributor]bool{}
+	for _, entry := range entries {
+		name, role := parseCSVContributor(entry)
+		contributor := models.Contributor{AuthorID: v.resolveName(row, "contributors", importAuthor, name), Role: role}
+		if contributor.AuthorID == 0 {
+			continue
+		}
+		if seen[contributor] {
+			v.fail(row, "contributors", fmt.Sprintf("%s is listed twice as %s", name, role))
+			continue
+		}
+		seen[contributor] = true
+		if role == models.ContributorAuthor && mainAuthor == "" {
+			mainAuthor = name
+		}
+		contributors = append(contributors, contributor)
+	}
+	if author != "" && nameKey(author) != nameKey(mainAuthor) {
+		v.fail(row, "author", "author must be the first author among the contributors")
+	}
+	return contributors, mainAuthor
+}
+
+// bookSubjects reads the subjects of a book. Without a subjects column the
+// category column names the sole subject; with one, the category column must
+// name the first subject.
+func (v *csvValidator) bookSubjects(row csvRow) []models.Subject {
+	category := row.get("category")
+	entries := splitCSVList(row.get("subjects"))
+	if len(entries) == 0 {
+		if id := v.resolve(row, "category", importCategory); id != 0 {
+			return []models.Subject{{CategoryID: id}}
+		}
+		return nil
+	}
+
+	var subjects []models.Subject
+	seen := map[int]bool{}
+	for _, name := range entries {
+		id := v.resolveName(row, "subjects", importCategory, name)
+		if id == 0 {
+			continue
+		}
+		if seen[id] {
+			v.fail(row, "subjects", fmt.Sprintf("%s is listed twice", name))
+			continue
+		}
+		seen[id] = true
+		subjects = append(subjects, models.Subject{CategoryID: id})
+	}
+	if category != "" && nameKey(category) != nameKey(entries[0]) {
+		v.fail(row, "category", "category must be the first of the subjects")
+	}
+	return subjects
+}
+
+func parseBookCSV(v *csvValidator, row csvRow) csvItem {
+	book := bookCSV{title: v.require(row, "title")}
+	if value := row.get("isbn"); value != "" {
+		parsed, err := isbn.Parse(value)
+		switch {
+		case err != nil:
+			v.fail(row, "isbn", err.Error())
+		case !v.unique(row, "isbn", parsed):
+		case v.exists("SELECT 1 FROM Books WHERE ISBN13 = ?", parsed):
+			v.fail(row, "isbn", errISBNTaken.Error())
+		}
+		book.isbn13 = parsed
+	}
+	var mainAuthor string
+	book.contributors, mainAuthor = v.bookContributors(row)
+	book.publisherID = v.resolve(row, "publisher", importPublisher)
+	book.subjects = v.bookSubjects(row)
+	if value := row.get("classification"); value != "" {
+		parsed, err := classification.Parse(row.get("classification_scheme"), value)
+		if err != nil {
+			v.fail(row, "classification", err.Error())
+			return book
+		}
+		book.classification = parsed
+		book.callNumber, book.callNumberSort = parsed.CallNumber(mainAuthor, book.title)
+	}
+	// The call number is always generated; an exported one is accepted only
+	// while it still matches.
+	if value := row.get("call_number"); value != "" && value != book.callNumber {
+		if book.callNumber == "" {
+			v.fail(row, "call_number", "call_number is generated from the classification; leave it empty")
+		} else {
+			v.fail(row, "call_number", fmt.Sprintf("call_number is generated from the classification as %s; leave it empty", book.callNumber))
+		}
+	}
+	return book
+}
+
+func (b bookCSV) insert(tx *sql.Tx) (int, error) {
+	id, err := insertID(tx, `INSERT INTO Books (Title, ISBN13, PublisherID, ClassificationScheme, Classification, CallNumber, CallNumberSort)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, b.title, isbnValue(b.isbn13), nullID(b.publisherID),
+		nullString(b.classification.Scheme), nullString(b.classification.Text), nullString(b.callNumber), nullString(b.callNumberSort))
+	if err != nil {
+		return 0, err
+	}
+	if err := saveContributors(tx, id, b.contributors); err != nil {
+		return 0, err
+	}
+	return id, saveSubjects(tx, id, b.subjects)
+}
+
+func (b bookCSV) index(idx *search.Index, id int) {
+	idx.PutBook(id, b.title, contributorIDs(b.contributors), subjectIDs(b.subjects))
+}
+
+type authorCSV models.Author
+
+func parseAuthorCSV(v *csvValidator, row csvRow) csvItem {
+	return authorCSV{Name: v.newName(row, importAuthor), Biography: row.get("biography")}
+}
+
+func (a authorCSV) insert(tx *sql.Tx) (int, error) {
+	return insertID(tx, "INSERT INTO Authors (Name, Biography) VALUES (?, ?)", a.Name, a.Biography)
+}
+
+func (a authorCSV) index(idx *search.Index, id int) {
+	idx.PutAuthor(id, a.Name, a.Biography)
+}
+
+type publisherCSV models.Publisher
+
+func parsePublisherCSV(v *csvValidator, row csvRow) csvItem {
+	return publisherCSV{Name: v.newName(row, importPublisher), Address: row.get("address")}
+}
+
+func (p publisherCSV) insert(tx *sql.Tx) (int, error) {
+	return insertID(tx, "INSERT INTO Publishers (Name, Address) VALUES (?, ?)", p.Name, p.Address)
+}
+
+// Publishers are not in the search index.
+func (p publisherCSV) index(idx *search.Index, id int) {}
+
+type categoryCSV models.Category
+
+// parseCategoryCSV validates a category. Its parent is given by name and must
+// already be in the catalogue, so a hierarchy is imported a level at a time.
+func parseCategoryCSV(v *csvValidator, row csvRow) csvItem {
+	category := categoryCSV{Name: v.newName(row, importCategory), Description: row.get("description")}
+	if parentID := v.resolve(row, "parent", importCategory); parentID != 0 {
+		category.ParentID = &parentID
+	}
+	return category
+}
+
+func (c categoryCSV) insert(tx *sql.Tx) (int, error) {
+	return insertID(tx, "INSERT INTO Categories (Name, Description, ParentID) VALUES (?, ?, ?)", c.Name, c.Description, c.ParentID)
+}
+
+func (c categoryCSV) index(idx *search.Index, id int) {
+	idx.PutCategory(id, c.Name)
+}
+
+type userCSV models.User
+
+// parseUserCSV validates a user by the same rules as a user created through
+// the API. Role and status default to patron and active; a user imported
+// without a password cannot log in until one is set.
+func parseUserCSV(v *csvValidator, row csvRow) csvItem {
+	user := userCSV{Name: row.get("name"), Email: row.get("email"), Password: row.get("password"),
+		Role: row.get("role"), Status: row.get("status")}
+	v.validate(row, models.User(user))
+	if user.Email != "" && v.unique(row, "email", strings.ToLower(user.Email)) &&
+		v.exists("SELECT 1 FROM Users WHERE Email = ?", user.Email) {
+		v.fail(row, "email", "A user with this email already exists")
+	}
+
+	if user.Role == "" {
+		user.Role = models.RolePatron
+	}
+	if user.Status == "" {
+		user.Status = models.UserActive
+	}
+	if value := row.get("expiry_date"); value != "" {
+		expiryDate, err := parseDateParam(value)
+		if err != nil {
+			v.fail(row, "expiry_date", "expiry_date must be in YYYY-MM-DD format")
+		} else {
+			user.ExpiryDate = &expiryDate
+		}
+	}
+	return user
+}
+
+func (u userCSV) insert(tx *sql.Tx) (int, error) {
+	var passwordHash sql.NullString
+	if u.Password != "" {
+		hash, err := hashPassword(u.Password)
+		if err != nil {
+			return 0, err
+		}
+		passwordHash = sql.NullString{String: hash, Valid: true}
+	}
+	return insertID(tx, "INSERT INTO Users (Name, Email, PasswordHash, Role, Status, ExpiryDate) VALUES (?, ?, ?, ?, ?, ?)",
+		u.Name, u.Email, passwordHash, u.Role, u.Status, formatDate(u.ExpiryDate))
+}
+
+func (u userCSV) index(idx *search.Index, id int) {
+	idx.PutUser(id, u.Name, u.Email)
+}
+
+// insertID runs an insert and returns the ID of the new row.
+func insertID(tx *sql.Tx, query string, args ...interface{}) (int, error) {
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// CSVCodeInvalidRows is the code of the problem returned when rows of an
+// imported CSV file have errors; the problem's report lists them.
+const CSVCodeInvalidRows = "invalid_rows"
+
+// ImportCSV godoc
+// @Summary Import a resource from a CSV file
+// @Description Create the books, authors, publishers, categories or users listed in a CSV file, sent as the file field of a multipart form or as the raw request body. The first line names the columns, in any order and case; the columns are those of the export, and the ID column is ignored. Fields may be separated by commas or semicolons. A book's authors, publisher and categories are given by name and matched against the catalogue ignoring case and Polish diacritics; they must already exist. The contributors column lists every contributor separated by |, each with its role in parentheses, such as "Jan Kowalski (translator)", and the subjects column lists the categories the same way; when they are given, author and category must name the first author and the first subject. A book's classification must follow the syntax of its classification_scheme, udc or ddc, and its call number is generated from it; a call_number sent in the file must match the generated one. Categories name their parent category, which must already exist, and users may also have a password column. Every row is validated first, and the file is imported in a single transaction only when no row has errors, so either all rows are saved or none. With dry_run=true the rows are only validated. Rows with errors are listed in the report member of the 422 problem. Books and publishers can be imported by librarians; authors, categories and users by administrators.
+// @Tags import
+// @Accept  text/csv,mpfd
+// @Produce  json
+// @Param resource path string true "Resource" Enums(books, authors, publishers, categories, users)
+// @Param dry_run query bool false "Only validate the file"
+// @Param file formData file false "CSV file"
+// @Success 200 {object} models.CSVImportReport
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 413 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /import/csv/{resource} [post]
+func (h *ImportHandler) ImportCSV(c *gin.Context) {
+	name := c.Param("resource")
+	resource, ok := csvResources[name]
+	if !ok {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Resource not found")
+		return
+	}
+	if user, _ := CurrentUser(c); !hasRole(user, resource.role) {
+		writeProblem(c, http.StatusForbidden, ProblemCodeForbidden, "Insufficient permissions")
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "dry_run must be true or false")
+		return
+	}
+
+	data, err := readUpload(c)
+	if err != nil {
+		writeUploadError(c, err)
+		return
+	}
+	rows, err := readCSV(data, resource.required)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+		return
+	}
+	v, err := h.newCSVValidator()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	items := make([]csvItem, len(rows))
+	for i, row := range rows {
+		items[i] = resource.parse(v, row)
+	}
+	if v.err != nil {
+		writeError(c, v.err)
+		return
+	}
+
+	report := models.CSVImportReport{Resource: name, DryRun: dryRun, Rows: len(rows), Errors: v.errors}
+	if len(report.Errors) > 0 {
+		problem := newProblem(http.StatusUnprocessableEntity, CSVCodeInvalidRows, fmt.Sprintf("%d errors in the file; nothing was imported", len(report.Errors)))
+		problem.Report = &report
+		sendProblem(c, problem)
+		return
+	}
+	if dryRun {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
+	ids := make([]int, len(items))
+	for i, item := range items {
+		if ids[i], err = item.insert(tx); err != nil {
+			problem := requestProblem(c, err)
+			problem.Detail = fmt.Sprintf("row %d: %s", rows[i].line, problem.Detail)
+			sendProblem(c, problem)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	for i, item := range items {
+		item.index(h.Search, ids[i])
+	}
+	report.Imported = len(items)
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportCSV godoc
+// @Summary Export a resource as a CSV file
+// @Description Download all books, authors, publishers, categories or users as a CSV file, ordered by ID. Books name their main author, all their contributors with their roles, their publisher, main category and all their subjects, so an export can be imported again, and users are exported without passwords. Rows are written to the response as they are read from the database, so exports of any size use little memory.
+// @Tags import
+// @Produce  text/csv
+// @Param resource path string true "Resource" Enums(books, authors, publishers, categories, users)
+// @Success 200 {file} file
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /export/csv/{resource} [get]
+func (h *ImportHandler) ExportCSV(c *gin.Context) {
+	name := c.Param("resource")
+	resource, ok := csvResources[name]
+	if !ok {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Resource not found")
+		return
+	}
+	rows, err := h.DB.QueryContext(c.Request.Context(), resource.export)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="`+name+`.csv"`)
+	c.Status(http.StatusOK)
+
+	// Once rows are written the status can no longer change, so a later error
+	// only cuts the file short and is logged.
+	w := csv.NewWriter(c.Writer)
+	values := make([]sql.NullString, len(resource.columns))
+	dest := make([]interface{}, len(values))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	record := make([]string, len(values))
+	err = w.Write(resource.columns)
+	for err == nil && rows.Next() {
+		if err = rows.Scan(dest...); err != nil {
+			break
+		}
+		for i, value := range values {
+			record[i] = value.String
+		}
+		err = w.Write(record)
+	}
+	w.Flush()
+	if err = errors.Join(err, rows.Err(), w.Error()); err != nil {
+		c.Error(err)
+	}
+}
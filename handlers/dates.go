@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"database/sql"
+	"time"
+)
+
+// dateLayout and dateTimeLayout are the formats of the DATE and DATETIME
+// columns as returned by the driver.
+const (
+	dateLayout     = "2006-01-02"
+	dateTimeLayout = "2006-01-02 15:04:05"
+)
+
+// today returns the current local date with the clock part zeroed, matching
+// the DATE columns used throughout the schema.
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// parseDate converts a nullable DATE column into a date pointer.
+func parseDate(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	parsedDate, err := time.ParseInLocation(dateLayout, value.String, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &parsedDate
+}
+
+// parseDateTime converts a nullable DATETIME column into a time pointer.
+func parseDateTime(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	parsedTime, err := time.ParseInLocation(dateTimeLayout, value.String, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &parsedTime
+}
+
+// parseDateParam parses a YYYY-MM-DD query parameter.
+func parseDateParam(value string) (time.Time, error) {
+	return time.ParseInLocation(dateLayout, value, time.Local)
+}
+
+// formatDate prepares a date pointer for a DATE column, mapping nil to NULL.
+func formatDate(date *time.Time) interface{} {
+	if date == nil {
+		return nil
+	}
+	return date.Format(dateLayout)
+}
+
+// daysBetween returns the number of whole days from one date to another.
+func daysBetween(from, to time.Time) int {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Reasons a user may be refused a checkout.
+const (
+	ReasonAccountSuspended = "account_suspended"
+	ReasonAccountExpired   = "account_expired"
+	ReasonFinesOverLimit   = "fines_over_limit"
+	ReasonLoanLimitReached = "loan_limit_reached"
+)
+
+// checkEligibility evaluates every borrowing rule for a user and collects all
+// of the reasons the user may not borrow, rather than stopping at the first.
+// It returns sql.ErrNoRows when the user does not exist.
+func checkEligibility(q queryRower, policy Policy, userID int) (models.Eligibility, error) {
+	eligibility := models.Eligibility{UserID: userID, Reasons: []models.EligibilityReason{}}
+
+	var status string
+	var expiryDate sql.NullString
+	if err := q.QueryRow("SELECT Status, ExpiryDate FROM Users WHERE UserID = ?", userID).Scan(&status, &expiryDate); err != nil {
+		return eligibility, err
+	}
+	if status == models.UserSuspended {
+		eligibility.Reasons = append(eligibility.Reasons, models.EligibilityReason{
+			Code:    ReasonAccountSuspended,
+			Message: "The account is suspended",
+		})
+	}
+	if expiry := parseDate(expiryDate); expiry != nil && expiry.Before(today()) {
+		eligibility.Reasons = append(eligibility.Reasons, models.EligibilityReason{
+			Code:    ReasonAccountExpired,
+			Message: "The account expired on " + expiry.Format(dateLayout),
+		})
+	}
+
+	var outstanding float64
+	if err := q.QueryRow("SELECT COALESCE(SUM(Balance), 0) FROM Fines WHERE UserID = ? AND Status = ?", userID, models.FineOpen).Scan(&outstanding); err != nil {
+		return eligibility, err
+	}
+	if toCents(outstanding) > toCents(policy.MaxOutstandingFines) {
+		eligibility.Reasons = append(eligibility.Reasons, models.EligibilityReason{
+			Code:    ReasonFinesOverLimit,
+			Message: fmt.Sprintf("Outstanding fines of %.2f exceed the limit of %.2f", outstanding, policy.MaxOutstandingFines),
+		})
+	}
+
+	var activeLoans int
+	if err := q.QueryRow("SELECT CountActiveUserLoans(?)", userID).Scan(&activeLoans); err != nil {
+		return eligibility, err
+	}
+	if activeLoans >= policy.MaxActiveLoans {
+		eligibility.Reasons = append(eligibility.Reasons, models.EligibilityReason{
+			Code:    ReasonLoanLimitReached,
+			Message: fmt.Sprintf("%d books are already on loan, the limit is %d", activeLoans, policy.MaxActiveLoans),
+		})
+	}
+
+	eligibility.Eligible = len(eligibility.Reasons) == 0
+	return eligibility, nil
+}
+
+// GetUserEligibility godoc
+// @Summary Check whether a user may borrow
+// @Description Evaluate the borrowing rules for a user and list every reason a checkout would be refused
+// @Tags loans
+// @Accept  json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Success 200 {object} models.Eligibility
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /users/{id}/eligibility [get]
+func (h *LoanHandler) GetUserEligibility(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorizeOwner(c, id, models.RoleLibrarian) {
+		return
+	}
+	eligibility, err := checkEligibility(h.DB, h.Policy, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "User not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, eligibility)
+}
@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+type FineHandler struct {
+	DB *sql.DB
+}
+
+func NewFineHandler(db *sql.DB) *FineHandler {
+	return &FineHandler{DB: db}
+}
+
+// fineColumns lists the Fines columns in the order expected by scanFine.
+const fineColumns = "FineID, LoanID, UserID, Amount, Balance, Status, AssessedDate, WaivedBy, WaiveReason"
+
+// fineTransactionColumns lists the FineTransactions columns in the order
+// expected by scanFineTransaction.
+const fineTransactionColumns = "TransactionID, FineID, Type, Amount, BalanceAfter, RecordedBy, Note, CreatedAt"
+
+func scanFine(row rowScanner, fine *models.Fine) error {
+	var assessedDate, waivedBy, waiveReason sql.NullString
+	if err := row.Scan(&fine.FineID, &fine.LoanID, &fine.UserID, &fine.Amount, &fine.Balance, &fine.Status, &assessedDate, &waivedBy, &waiveReason); err != nil {
+		return err
+	}
+	fine.AssessedDate = parseDate(assessedDate)
+	fine.WaivedBy = waivedBy.String
+	fine.WaiveReason = waiveReason.String
+	return nil
+}
+
+func scanFineTransaction(row rowScanner, transaction *models.FineTransaction) error {
+	var recordedBy, note, createdAt sql.NullString
+	if err := row.Scan(&transaction.TransactionID, &transaction.FineID, &transaction.Type, &transaction.Amount, &transaction.BalanceAfter, &recordedBy, &note, &createdAt); err != nil {
+		return err
+	}
+	transaction.RecordedBy = recordedBy.String
+	transaction.Note = note.String
+	transaction.CreatedAt = parseDateTime(createdAt)
+	return nil
+}
+
+// toCents and fromCents keep fine arithmetic in whole grosze so that partial
+// payments never leave floating point residue on a balance.
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// fineAmount returns the fine for a loan returned the given number of days
+// late, capped per item when the policy sets a cap.
+func fineAmount(policy Policy, daysOverdue int) int64 {
+	cents := int64(daysOverdue) * toCents(policy.FineDailyRate)
+	if maxCents := toCents(policy.FineCap); maxCents > 0 && cents > maxCents {
+		cents = maxCents
+	}
+	return cents
+}
+
+// assessFine creates a fine for a late loan inside the caller's transaction.
+// It returns nil when the loan was not late or the policy charges nothing.
+func assessFine(tx *sql.Tx, policy Policy, loan models.Loan) (*models.Fine, error) {
+	cents := fineAmount(policy, loan.DaysOverdue)
+	if cents <= 0 {
+		return nil, nil
+	}
+
+	assessedDate := today()
+	fine := models.Fine{
+		LoanID:       loan.LoanID,
+		UserID:       loan.UserID,
+		Amount:       fromCents(cents),
+		Balance:      fromCents(cents),
+		Status:       models.FineOpen,
+		AssessedDate: &assessedDate,
+	}
+	result, err := tx.Exec("INSERT INTO Fines (LoanID, UserID, Amount, Balance, Status, AssessedDate) VALUES (?, ?, ?, ?, ?, ?)", fine.LoanID, fine.UserID, fine.Amount, fine.Balance, fine.Status, formatDate(fine.AssessedDate))
+	if err != nil {
+		return nil, err
+	}
+	fineID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	fine.FineID = int(fineID)
+
+	note := strconv.Itoa(loan.DaysOverdue) + " days overdue"
+	if err := recordFineTransaction(tx, fine.FineID, models.LedgerAssessment, cents, cents, "", note); err != nil {
+		return nil, err
+	}
+	return &fine, nil
+}
+
+// recordedBy identifies the authenticated librarian in the fines ledger by
+// their email address, which is unique.
+func recordedBy(c *gin.Context) string {
+	user, _ := CurrentUser(c)
+	return user.Email
+}
+
+// recordFineTransaction appends an entry to the fines ledger. Amounts are
+// signed: assessments increase the balance, payments and waivers decrease it.
+func recordFineTransaction(tx *sql.Tx, fineID int, transactionType string, amountCents, balanceAfterCents int64, recordedBy, note string) error {
+	_, err := tx.Exec("INSERT INTO FineTransactions (FineID, Type, Amount, BalanceAfter, RecordedBy, Note) VALUES (?, ?, ?, ?, ?, ?)", fineID, transactionType, fromCents(amountCents), fromCents(balanceAfterCents), recordedBy, note)
+	return err
+}
+
+// GetUserFines godoc
+// @Summary Get fines of a user
+// @Description Get a page of the fines assessed to a user given their ID
+// @Tags fines
+// @Accept  json
+// @Produce  json
+// @Param id path int true "User ID"
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, assessed_date, amount, balance" default(assessed_date)
+// @Param status query string false "Status" Enums(open, paid, waived)
+// @Success 200 {object} models.Page[models.Fine]
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /users/{id}/fines [get]
+func (h *FineHandler) GetUserFines(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorizeOwner(c, id, models.RoleLibrarian) {
+		return
+	}
+	h.writeUserFines(c, id)
+}
+
+// GetMyFines godoc
+// @Summary Get fines of the current user
+// @Description Get a page of the fines assessed to the authenticated user
+// @Tags me
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, assessed_date, amount, balance" default(assessed_date)
+// @Param status query string false "Status" Enums(open, paid, waived)
+// @Success 200 {object} models.Page[models.Fine]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /me/fines [get]
+func (h *FineHandler) GetMyFines(c *gin.Context) {
+	user, _ := CurrentUser(c)
+	h.writeUserFines(c, user.UserID)
+}
+
+// writeUserFines responds with a page of the fines assessed to a user,
+// oldest first unless sorted otherwise.
+func (h *FineHandler) writeUserFines(c *gin.Context, userID int) {
+	q := newListQuery(c, map[string]string{"id": "FineID", "assessed_date": "AssessedDate", "amount": "Amount", "balance": "Balance"}, "assessed_date")
+	q.filter("UserID = ?", userID)
+	q.filterString("status", "Status")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, fineColumns, "Fines")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	fines := []models.Fine{}
+	for rows.Next() {
+		var fine models.Fine
+		if err := scanFine(rows, &fine); err != nil {
+			writeError(c, err)
+			return
+		}
+		fines = append(fines, fine)
+	}
+	c.JSON(http.StatusOK, newPage(q, fines, total))
+}
+
+// GetFineByID godoc
+// @Summary Get details of a specific fine
+// @Description Get details of a fine given its ID, including its ledger entries
+// @Tags fines
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Fine ID"
+// @Success 200 {object} models.Fine
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /fines/{id} [get]
+func (h *FineHandler) GetFineByID(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var fine models.Fine
+	err := scanFine(h.DB.QueryRow("SELECT "+fineColumns+" FROM Fines WHERE FineID = ?", id), &fine)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Fine not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	if !authorizeOwner(c, fine.UserID, models.RoleLibrarian) {
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT "+fineTransactionColumns+" FROM FineTransactions WHERE FineID = ? ORDER BY TransactionID", id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var transaction models.FineTransaction
+		if err := scanFineTransaction(rows, &transaction); err != nil {
+			writeError(c, err)
+			return
+		}
+		fine.Transactions = append(fine.Transactions, transaction)
+	}
+	c.JSON(http.StatusOK, fine)
+}
+
+// GetFineLedger godoc
+// @Summary Get the fines ledger
+// @Description Get a page of the balance changes recorded on fines, oldest first. Use from and to (YYYY-MM-DD, inclusive) to reconcile a single day or period.
+// @Tags fines
+// @Accept  json
+// @Produce  json
+// @Param from query string false "First day to include"
+// @Param to query string false "Last day to include"
+// @Param fine_id query int false "Fine ID"
+// @Param type query string false "Entry type" Enums(assessment, payment, waiver)
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id" default(id)
+// @Success 200 {object} models.Page[models.FineTransaction]
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /fines/ledger [get]
+func (h *FineHandler) GetFineLedger(c *gin.Context) {
+	q := newListQuery(c, map[string]string{"id": "TransactionID"}, "id")
+	if from := c.Query("from"); from != "" {
+		if _, err := parseDateParam(from); err != nil {
+			writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "from must be a date in YYYY-MM-DD format")
+			return
+		}
+		q.filter("CreatedAt >= ?", from)
+	}
+	if to := c.Query("to"); to != "" {
+		toDate, err := parseDateParam(to)
+		if err != nil {
+			writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "to must be a date in YYYY-MM-DD format")
+			return
+		}
+		q.filter("CreatedAt < ?", toDate.AddDate(0, 0, 1).Format(dateLayout))
+	}
+	q.filterInt("fine_id", "FineID")
+	q.filterString("type", "Type")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+
+	total, rows, err := q.query(h.DB, fineTransactionColumns, "FineTransactions")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	transactions := []models.FineTransaction{}
+	for rows.Next() {
+		var transaction models.FineTransaction
+		if err := scanFineTransaction(rows, &transaction); err != nil {
+			writeError(c, err)
+			return
+		}
+		transactions = append(transactions, transaction)
+	}
+	c.JSON(http.StatusOK, newPage(q, transactions, total))
+}
+
+// Codes of the problems returned when a payment or waiver is refused.
+const (
+	FineCodeClosed      = "fine_closed"
+	FineCodeOverpayment = "overpayment"
+)
+
+// PayFine godoc
+// @Summary Pay a fine
+// @Description Record a full or partial payment against an open fine. The payment is recorded under the authenticated librarian. The fine is marked paid once its balance reaches zero.
+// @Tags fines
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Fine ID"
+// @Param payment body models.FinePayment true "Payment"
+// @Success 200 {object} models.Fine
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /fines/{id}/payments [post]
+func (h *FineHandler) PayFine(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var payment models.FinePayment
+	if err := c.ShouldBindJSON(&payment); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	paidCents := toCents(payment.Amount)
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var fine models.Fine
+	err = scanFine(tx.QueryRow("SELECT "+fineColumns+" FROM Fines WHERE FineID = ? FOR UPDATE", id), &fine)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Fine not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	if fine.Status != models.FineOpen {
+		writeProblem(c, http.StatusConflict, FineCodeClosed, "Fine is already "+fine.Status)
+		return
+	}
+	balanceCents := toCents(fine.Balance)
+	if paidCents > balanceCents {
+		writeProblem(c, http.StatusConflict, FineCodeOverpayment, "Payment exceeds the outstanding balance")
+		return
+	}
+
+	balanceCents -= paidCents
+	fine.Balance = fromCents(balanceCents)
+	if balanceCents == 0 {
+		fine.Status = models.FinePaid
+	}
+	if _, err := tx.Exec("UPDATE Fines SET Balance = ?, Status = ? WHERE FineID = ?", fine.Balance, fine.Status, fine.FineID); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := recordFineTransaction(tx, fine.FineID, models.LedgerPayment, -paidCents, balanceCents, recordedBy(c), payment.Note); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, fine)
+}
+
+// WaiveFine godoc
+// @Summary Waive a fine
+// @Description Cancel the outstanding balance of an open fine, recording the authenticated librarian as the one who waived it and the reason why
+// @Tags fines
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Fine ID"
+// @Param waiver body models.FineWaiver true "Waiver"
+// @Success 200 {object} models.Fine
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /fines/{id}/waive [post]
+func (h *FineHandler) WaiveFine(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var waiver models.FineWaiver
+	if err := c.ShouldBindJSON(&waiver); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	var fine models.Fine
+	err = scanFine(tx.QueryRow("SELECT "+fineColumns+" FROM Fines WHERE FineID = ? FOR UPDATE", id), &fine)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Fine not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	if fine.Status != models.FineOpen {
+		writeProblem(c, http.StatusConflict, FineCodeClosed, "Fine is already "+fine.Status)
+		return
+	}
+
+	waivedCents := toCents(fine.Balance)
+	fine.Balance = 0
+	fine.Status = models.FineWaived
+	fine.WaivedBy = recordedBy(c)
+	fine.WaiveReason = waiver.Reason
+	if _, err := tx.Exec("UPDATE Fines SET Balance = 0, Status = ?, WaivedBy = ?, WaiveReason = ? WHERE FineID = ?", fine.Status, fine.WaivedBy, fine.WaiveReason, fine.FineID); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := recordFineTransaction(tx, fine.FineID, models.LedgerWaiver, -waivedCents, 0, fine.WaivedBy, waiver.Reason); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, fine)
+}
@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"books_rent/classification"
+	"books_rent/isbn"
+	"books_rent/marc"
+	"books_rent/models"
+	"books_rent/search"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type ImportHandler struct {
+	DB     *sql.DB
+	Search *search.Index
+}
+
+func NewImportHandler(db *sql.DB, index *search.Index) *ImportHandler {
+	return &ImportHandler{DB: db, Search: index}
+}
+
+// maxImportSize is the largest file accepted for import.
+const maxImportSize = 32 << 20
+
+// Types of the entries of an import report.
+const (
+	importBook      = "book"
+	importAuthor    = "author"
+	importPublisher = "publisher"
+	importCategory  = "category"
+)
+
+// readUpload returns the uploaded file, sent either as the file field of a
+// multipart form or as the raw request body.
+func readUpload(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	if c.ContentType() != "multipart/form-data" {
+		return io.ReadAll(c.Request.Body)
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		return nil, err
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// writeUploadError responds to a failed readUpload call.
+func writeUploadError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeProblem(c, http.StatusRequestEntityTooLarge, ProblemCodeTooLarge, fmt.Sprintf("file is larger than %d MB", maxImportSize>>20))
+		return
+	}
+	writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+}
+
+// nameKey folds a name for matching, so that imported names match existing
+// ones regardless of case, diacritics and punctuation.
+func nameKey(name string) string {
+	return strings.Join(search.Tokens(name), " ")
+}
+
+// names maps the name keys of authors, publishers or categories to their IDs.
+type names map[string]int
+
+func loadNames(db *sql.DB, query string) (names, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := names{}
+	for rows.Next() {
+		var id int
+		var name sql.NullString
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		if key := nameKey(name.String); key != "" {
+			if _, ok := known[key]; !ok {
+				known[key] = id
+			}
+		}
+	}
+	return known, rows.Err()
+}
+
+// nullID prepares an optional foreign key, mapping 0 to NULL.
+func nullID(id int) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// importer saves the records of one import, matching the authors, publishers
+// and categories they name against those already in the catalogue and those
+// created by earlier records.
+// The known names are kept by entry type.
+type importer struct {
+	db     *sql.DB
+	search *search.Index
+	known  map[string]names
+}
+
+func (h *ImportHandler) newImporter() (*importer, error) {
+	known, err := loadKnownNames(h.DB)
+	if err != nil {
+		return nil, err
+	}
+	return &importer{db: h.DB, search: h.Search, known: known}, nil
+}
+
+// loadKnownNames loads the names of the authors, publishers and categories in
+// the catalogue, by entry type.
+func loadKnownNames(db *sql.DB) (map[string]names, error) {
+	queries := map[string]string{
+		importAuthor:    "SELECT AuthorID, Name FROM Authors ORDER BY AuthorID",
+		importPublisher: "SELECT PublisherID, Name FROM Publishers ORDER BY PublisherID",
+		importCategory:  "SELECT CategoryID, Name FROM Categories ORDER BY CategoryID",
+	}
+	known := map[string]names{}
+	for entryType, query := range queries {
+		loaded, err := loadNames(db, query)
+		if err != nil {
+			return nil, err
+		}
+		known[entryType] = loaded
+	}
+	return known, nil
+}
+
+// recordImport collects what a record creates inside its transaction. The
+// names it creates only become known to the importer once it commits.
+type recordImport struct {
+	tx      *sql.Tx
+	known   map[string]names
+	pending map[string]names
+	entries []models.ImportEntry
+}
+
+// resolve returns the ID of the author, publisher or category with the name,
+// creating it with insert when none matches, and records the entry.
+func (r *recordImport) resolve(entryType, name, insert string, args ...interface{}) (int, error) {
+	key := nameKey(name)
+	id, ok := r.known[entryType][key]
+	if !ok {
+		id, ok = r.pending[entryType][key]
+	}
+	status := models.ImportMatched
+	if !ok {
+		result, err := r.tx.Exec(insert, args...)
+		if err != nil {
+			return 0, err
+		}
+		newID, err := result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+		id, status = int(newID), models.ImportCreated
+		if r.pending[entryType] == nil {
+			r.pending[entryType] = names{}
+		}
+		r.pending[entryType][key] = id
+	}
+	r.entries = append(r.entries, models.ImportEntry{Type: entryType, ID: id, Name: name, Status: status})
+	return id, nil
+}
+
+// relatorRoles maps MARC relator codes and common English and Polish relator
+// terms to contributor roles. Any other relator, or none, means author.
+var relatorRoles = map[string]string{
+	"edt":         models.ContributorEditor,
+	"editor":      models.ContributorEditor,
+	"red":         models.ContributorEditor,
+	"redakcja":    models.ContributorEditor,
+	"redaktor":    models.ContributorEditor,
+	"trl":         models.ContributorTranslator,
+	"translator":  models.ContributorTranslator,
+	"tł":          models.ContributorTranslator,
+	"tłum":        models.ContributorTranslator,
+	"tłumacz":     models.ContributorTranslator,
+	"tłumaczenie": models.ContributorTranslator,
+	"ill":         models.ContributorIllustrator,
+	"illustrator": models.ContributorIllustrator,
+	"il":          models.ContributorIllustrator,
+	"ilustrator":  models.ContributorIllustrator,
+	"ilustracje":  models.ContributorIllustrator,
+}
+
+func relatorRole(relator string) string {
+	if role, ok := relatorRoles[relator]; ok {
+		return role
+	}
+	return models.ContributorAuthor
+}
+
+// recordClassification returns the record's UDC number, or else its Dewey
+// number. A number that does not follow its scheme's syntax is left out
+// rather than failing the record.
+func recordClassification(record *marc.Record) (classification.Number, bool) {
+	if number, err := classification.Parse(classification.UDC, record.UDC()); err == nil {
+		return number, true
+	}
+	if number, err := classification.Parse(classification.DDC, record.Dewey()); err == nil {
+		return number, true
+	}
+	return classification.Number{}, false
+}
+
+// importRecord saves a single record in its own transaction. A book is
+// matched by its ISBN or, for records without one, by its title and main
+// author; otherwise it is created along with any author, publisher or
+// category not yet in the catalogue. The people named in the record become
+// the book's contributors, and its subjects become categories it is filed
+// under.
+func (imp *importer) importRecord(ctx context.Context, record *marc.Record) models.ImportRecord {
+	report := models.ImportRecord{ControlNumber: strings.TrimSpace(record.ControlField("001")), Title: record.Title()}
+	fail := func(err error) models.ImportRecord {
+		report.Status = models.ImportFailed
+		report.Error = errorDetail(err)
+		report.Entries = nil
+		return report
+	}
+	if report.Title == "" {
+		return fail(errors.New("record has no title in field 245"))
+	}
+
+	var isbn13 string
+	isbns := record.ISBNs()
+	for _, value := range isbns {
+		if parsed, err := isbn.Parse(value); err == nil {
+			isbn13 = parsed
+			break
+		}
+	}
+	if len(isbns) > 0 && isbn13 == "" {
+		return fail(fmt.Errorf("invalid ISBN %s", isbns[0]))
+	}
+	if isbn13 != "" {
+		var bookID int
+		err := imp.db.QueryRowContext(ctx, "SELECT BookID FROM Books WHERE ISBN13 = ?", isbn13).Scan(&bookID)
+		if err == nil {
+			report.Status = models.ImportMatched
+			report.Entries = []models.ImportEntry{{Type: importBook, ID: bookID, Name: report.Title, Status: models.ImportMatched}}
+			return report
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return fail(err)
+		}
+	}
+
+	tx, err := imp.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+	r := &recordImport{tx: tx, known: imp.known, pending: map[string]names{}}
+
+	var contributors []models.Contributor
+	var authorName string
+	seen := map[models.Contributor]bool{}
+	for _, person := range record.Contributors() {
+		id, err := r.resolve(importAuthor, person.Name, "INSERT INTO Authors (Name) VALUES (?)", person.Name)
+		if err != nil {
+			return fail(err)
+		}
+		contributor := models.Contributor{AuthorID: id, Role: relatorRole(person.Relator)}
+		if contributor.Role == models.ContributorAuthor && authorName == "" {
+			authorName = person.Name
+		}
+		if !seen[contributor] {
+			seen[contributor] = true
+			contributors = append(contributors, contributor)
+		}
+	}
+	authorID := mainAuthor(contributors)
+	var publisherID int
+	if name, place := record.Publisher(); name != "" {
+		if publisherID, err = r.resolve(importPublisher, name, "INSERT INTO Publishers (Name, Address) VALUES (?, ?)", name, place); err != nil {
+			return fail(err)
+		}
+	}
+	var subjects []models.Subject
+	filed := map[int]bool{}
+	for _, name := range record.Subjects() {
+		id, err := r.resolve(importCategory, name, "INSERT INTO Categories (Name) VALUES (?)", name)
+		if err != nil {
+			return fail(err)
+		}
+		if !filed[id] {
+			filed[id] = true
+			subjects = append(subjects, models.Subject{CategoryID: id})
+		}
+	}
+
+	var bookID int
+	if isbn13 == "" {
+		if bookID, err = findBookByTitle(tx, report.Title, authorID); err != nil {
+			return fail(err)
+		}
+	}
+	bookStatus := models.ImportMatched
+	if bookID == 0 {
+		var scheme, number, callNumber string
+		var sortKey interface{}
+		if parsed, ok := recordClassification(record); ok {
+			scheme, number = parsed.Scheme, parsed.Text
+			callNumber, sortKey = parsed.CallNumber(authorName, report.Title)
+		}
+		language := record.Language()
+		if !languagePattern.MatchString(language) {
+			language = ""
+		}
+		result, err := tx.Exec(`INSERT INTO Books (Title, ISBN13, PublisherID, PublicationYear, Language,
+			ClassificationScheme, Classification, CallNumber, CallNumberSort) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			report.Title, isbnValue(isbn13), nullID(publisherID), nullInt(record.Year()), nullString(language),
+			nullString(scheme), nullString(number), nullString(callNumber), sortKey)
+		if err != nil {
+			return fail(err)
+		}
+		newID, err := result.LastInsertId()
+		if err != nil {
+			return fail(err)
+		}
+		bookID, bookStatus = int(newID), models.ImportCreated
+		if err := saveContributors(tx, bookID, contributors); err != nil {
+			return fail(err)
+		}
+		if err := saveSubjects(tx, bookID, subjects); err != nil {
+			return fail(err)
+		}
+	}
+	r.entries = append([]models.ImportEntry{{Type: importBook, ID: bookID, Name: report.Title, Status: bookStatus}}, r.entries...)
+
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+
+	for entryType, created := range r.pending {
+		for key, id := range created {
+			imp.known[entryType][key] = id
+		}
+	}
+	for _, entry := range r.entries {
+		if entry.Status != models.ImportCreated {
+			continue
+		}
+		switch entry.Type {
+		case importAuthor:
+			imp.search.PutAuthor(entry.ID, entry.Name, "")
+		case importCategory:
+			imp.search.PutCategory(entry.ID, entry.Name)
+		case importBook:
+			imp.search.PutBook(entry.ID, report.Title, contributorIDs(contributors), subjectIDs(subjects))
+		}
+	}
+	report.Status = bookStatus
+	report.Entries = r.entries
+	return report
+}
+
+// findBookByTitle returns the ID of a book without an ISBN with the title and
+// main author, or 0 when there is none. It is how records without an ISBN are
+// matched, so that importing the same file twice does not duplicate them.
+func findBookByTitle(tx *sql.Tx, title string, authorID int) (int, error) {
+	rows, err := tx.Query("SELECT BookID, Title FROM BookAvailability WHERE ISBN13 IS NULL AND AuthorID <=> ? ORDER BY BookID", nullID(authorID))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	key := nameKey(title)
+	for rows.Next() {
+		var id int
+		var existing sql.NullString
+		if err := rows.Scan(&id, &existing); err != nil {
+			return 0, err
+		}
+		if nameKey(existing.String) == key {
+			return id, nil
+		}
+	}
+	return 0, rows.Err()
+}
+
+// ImportMARC godoc
+// @Summary Import books from a MARC21 or MARCXML file
+// @Description Catalogue the records of a binary MARC21 (ISO 2709) or MARCXML file, sent as the file field of a multipart form or as the raw request body. Each record yields a book with its title (245), contributors (100 and 700, with the role taken from the relator code or term), publisher (264 or 260), ISBN (020), subjects (650), which become categories, year and language of publication (008) and classification (UDC from 080, or else Dewey from 082). Authors, publishers and categories are matched by name, ignoring case and Polish diacritics, and created when missing. A book already in the catalogue is matched by its ISBN, or by title and main author when the record has no ISBN, and is left unchanged. Every record is saved in its own transaction, and the report lists what each record created, matched or why it failed.
+// @Tags import
+// @Accept  octet-stream,xml,mpfd
+// @Produce  json
+// @Param file formData file false "MARC21 or MARCXML file"
+// @Success 200 {object} models.ImportReport
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 413 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /import/marc [post]
+func (h *ImportHandler) ImportMARC(c *gin.Context) {
+	data, err := readUpload(c)
+	if err != nil {
+		writeUploadError(c, err)
+		return
+	}
+	results, err := marc.Parse(data)
+	if err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+		return
+	}
+	imp, err := h.newImporter()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	report := models.ImportReport{Records: []models.ImportRecord{}}
+	for i, result := range results {
+		var record models.ImportRecord
+		if result.Err != nil {
+			record = models.ImportRecord{Status: models.ImportFailed, Error: result.Err.Error()}
+		} else {
+			record = imp.importRecord(c.Request.Context(), result.Record)
+		}
+		record.Index = i + 1
+		switch record.Status {
+		case models.ImportCreated:
+			report.Created++
+		case models.ImportMatched:
+			report.Matched++
+		default:
+			report.Failed++
+		}
+		report.Records = append(report.Records, record)
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"strconv"
+	"strings"
+)
+
+// Page sizes accepted by the limit query parameter.
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// likeEscaper escapes the LIKE wildcards in user input.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// listQuery reads the paging, sorting and filtering query parameters shared by
+// the list endpoints and turns them into SQL. Parameter errors are collected
+// in err so that a handler can register all of its filters and check once.
+type listQuery struct {
+	c      *gin.Context
+	limit  int
+	offset int
+	order  string
+	where  []string
+	args   []interface{}
+	err    error
+}
+
+// newPageQuery reads limit and offset for an endpoint that pages through
+// results it does not sort or filter in SQL.
+func newPageQuery(c *gin.Context) *listQuery {
+	q := &listQuery{c: c, limit: defaultPageLimit}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			q.fail(fmt.Errorf("limit must be an integer between 1 and %d", maxPageLimit))
+		}
+		q.limit = limit
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			q.fail(fmt.Errorf("offset must be a non-negative integer"))
+		}
+		q.offset = offset
+	}
+	return q
+}
+
+// newListQuery reads limit, offset and sort. sortable maps every field that
+// may be passed to sort to its column; a leading "-" sorts descending.
+// defaultSort is used when sort is absent. When sortable has an "id" field
+// its column breaks ties so that pages never overlap.
+func newListQuery(c *gin.Context, sortable map[string]string, defaultSort string) *listQuery {
+	q := newPageQuery(c)
+
+	sort := c.DefaultQuery("sort", defaultSort)
+	field, descending := strings.CutPrefix(sort, "-")
+	column, ok := sortable[field]
+	if !ok {
+		q.fail(fmt.Errorf("cannot sort by %q", field))
+		return q
+	}
+	q.order = column
+	if descending {
+		q.order += " DESC"
+	}
+	if id, ok := sortable["id"]; ok && id != column {
+		q.order += ", " + id
+	}
+	return q
+}
+
+func (q *listQuery) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// filter adds a condition to the WHERE clause.
+func (q *listQuery) filter(condition string, args ...interface{}) {
+	q.where = append(q.where, condition)
+	q.args = append(q.args, args...)
+}
+
+// filterInt filters on column = param when param is present.
+func (q *listQuery) filterInt(param, column string) {
+	q.filterIntWhere(param, column+" = ?")
+}
+
+// filterIntWhere adds condition, whose one placeholder takes the integer
+// param, when param is present.
+func (q *listQuery) filterIntWhere(param, condition string) {
+	value := q.c.Query(param)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		q.fail(fmt.Errorf("%s must be an integer", param))
+		return
+	}
+	q.filter(condition, n)
+}
+
+// filterBool filters on column = param when param is present.
+func (q *listQuery) filterBool(param, column string) {
+	value := q.c.Query(param)
+	if value == "" {
+		return
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		q.fail(fmt.Errorf("%s must be true or false", param))
+		return
+	}
+	q.filter(column+" = ?", b)
+}
+
+// filterNull keeps the rows where column is NULL when param is true and the
+// rows where it is set when param is false.
+func (q *listQuery) filterNull(param, column string) {
+	value := q.c.Query(param)
+	if value == "" {
+		return
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		q.fail(fmt.Errorf("%s must be true or false", param))
+		return
+	}
+	if b {
+		q.filter(column + " IS NULL")
+	} else {
+		q.filter(column + " IS NOT NULL")
+	}
+}
+
+// filterString filters on column = param when param is present.
+func (q *listQuery) filterString(param, column string) {
+	if value := q.c.Query(param); value != "" {
+		q.filter(column+" = ?", value)
+	}
+}
+
+// filterContains keeps the rows whose column contains param.
+func (q *listQuery) filterContains(param, column string) {
+	if value := q.c.Query(param); value != "" {
+		q.filter(column+" LIKE ?", "%"+likeEscaper.Replace(value)+"%")
+	}
+}
+
+func (q *listQuery) whereClause() string {
+	if len(q.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.where, " AND ")
+}
+
+// query counts every row matching the filters and selects the requested page
+// of them. from is the table or view, with its alias if columns use one.
+func (q *listQuery) query(db *sql.DB, columns, from string) (int, *sql.Rows, error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM "+from+q.whereClause(), q.args...).Scan(&total); err != nil {
+		return 0, nil, err
+	}
+	args := append(append([]interface{}{}, q.args...), q.limit, q.offset)
+	rows, err := db.Query("SELECT "+columns+" FROM "+from+q.whereClause()+" ORDER BY "+q.order+" LIMIT ? OFFSET ?", args...)
+	return total, rows, err
+}
+
+// link returns the current request URL pointing at the page starting at
+// offset, keeping every other query parameter.
+func (q *listQuery) link(offset int) *string {
+	u := *q.c.Request.URL
+	values := u.Query()
+	values.Set("limit", strconv.Itoa(q.limit))
+	values.Set("offset", strconv.Itoa(offset))
+	u.RawQuery = values.Encode()
+	link := u.RequestURI()
+	return &link
+}
+
+// newPage wraps one page of items with the total count and the links to the
+// neighbouring pages.
+func newPage[T any](q *listQuery, items []T, total int) models.Page[T] {
+	page := models.Page[T]{Items: items, Total: total, Limit: q.limit, Offset: q.offset}
+	if q.offset+q.limit < total {
+		page.Next = q.link(q.offset + q.limit)
+	}
+	if q.offset > 0 {
+		prev := q.offset - q.limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.Prev = q.link(prev)
+	}
+	return page
+}
@@ -7,90 +7,350 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
-	"time"
 )
 
 type LoanHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Policy Policy
 }
 
-func NewLoanHandler(db *sql.DB) *LoanHandler {
-	return &LoanHandler{DB: db}
+func NewLoanHandler(db *sql.DB, policy Policy) *LoanHandler {
+	return &LoanHandler{DB: db, Policy: policy}
+}
+
+// loanColumns lists the Loans columns in the order expected by scanLoan.
+const loanColumns = "LoanID, BookID, CopyID, UserID, LoanDate, DueDate, ReturnDate, RenewalCount"
+
+// loanSortFields are the fields loans can be sorted by.
+var loanSortFields = map[string]string{"id": "LoanID", "loan_date": "LoanDate", "due_date": "DueDate", "return_date": "ReturnDate"}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanLoan reads a row selected with loanColumns and fills in the overdue
+// fields.
+func scanLoan(row rowScanner, loan *models.Loan) error {
+	var loanDate, dueDate, returnDate sql.NullString
+	var copyID sql.NullInt64
+	if err := row.Scan(&loan.LoanID, &loan.BookID, &copyID, &loan.UserID, &loanDate, &dueDate, &returnDate, &loan.RenewalCount); err != nil {
+		return err
+	}
+	loan.CopyID = int(copyID.Int64)
+	loan.LoanDate = parseDate(loanDate)
+	loan.DueDate = parseDate(dueDate)
+	loan.ReturnDate = parseDate(returnDate)
+	setOverdue(loan)
+	return nil
+}
+
+// setOverdue computes how late a loan is. A returned loan is measured at its
+// return date, an active one at today's date; only active loans are flagged
+// as overdue.
+func setOverdue(loan *models.Loan) {
+	loan.Overdue = false
+	loan.DaysOverdue = 0
+	if loan.DueDate == nil {
+		return
+	}
+	asOf := today()
+	if loan.ReturnDate != nil {
+		asOf = *loan.ReturnDate
+	}
+	if days := daysBetween(*loan.DueDate, asOf); days > 0 {
+		loan.DaysOverdue = days
+		loan.Overdue = loan.ReturnDate == nil
+	}
 }
 
 // GetLoans godoc
 // @Summary Get a list of loans
-// @Description Get a list of all loans
+// @Description Get a page of loans, optionally filtered by user, book, copy or whether the book is still out
 // @Tags loans
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Loan
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, loan_date, due_date, return_date" default(id)
+// @Param user_id query int false "User ID"
+// @Param book_id query int false "Book ID"
+// @Param copy_id query int false "Copy ID"
+// @Param active query bool false "true for loans not yet returned, false for returned loans"
+// @Success 200 {object} models.Page[models.Loan]
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /loans [get]
-
 func (h *LoanHandler) GetLoans(c *gin.Context) {
-	var loans []models.Loan
-	rows, err := h.DB.Query("SELECT LoanID, BookID, UserID, LoanDate, ReturnDate FROM Loans")
+	q := newListQuery(c, loanSortFields, "id")
+	q.filterInt("user_id", "UserID")
+	q.filterInt("book_id", "BookID")
+	q.filterInt("copy_id", "CopyID")
+	q.filterNull("active", "ReturnDate")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	writeLoans(c, h.DB, q)
+}
+
+// GetOverdueLoans godoc
+// @Summary Get overdue loans
+// @Description Get a page of loans that have not been returned and are past their due date, most overdue first
+// @Tags loans
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, loan_date, due_date, return_date" default(due_date)
+// @Param user_id query int false "User ID"
+// @Param book_id query int false "Book ID"
+// @Success 200 {object} models.Page[models.Loan]
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /loans/overdue [get]
+func (h *LoanHandler) GetOverdueLoans(c *gin.Context) {
+	q := newListQuery(c, loanSortFields, "due_date")
+	q.filter("ReturnDate IS NULL AND DueDate < ?", today().Format(dateLayout))
+	q.filterInt("user_id", "UserID")
+	q.filterInt("book_id", "BookID")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	writeLoans(c, h.DB, q)
+}
+
+// writeLoans responds with the page of loans selected by q.
+func writeLoans(c *gin.Context, db *sql.DB, q *listQuery) {
+	total, rows, err := q.query(db, loanColumns, "Loans")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
+	loans := []models.Loan{}
 	for rows.Next() {
 		var loan models.Loan
-		var loanDate sql.NullString
-		var returnDate sql.NullString
-		if err := rows.Scan(&loan.LoanID, &loan.BookID, &loan.UserID, &loanDate, &returnDate); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := scanLoan(rows, &loan); err != nil {
+			writeError(c, err)
 			return
 		}
-
-		if loanDate.Valid {
-			parsedDate, _ := time.Parse("2006-01-02", loanDate.String)
-			loan.LoanDate = &parsedDate
-		}
-
-		if returnDate.Valid {
-			parsedDate, _ := time.Parse("2006-01-02", returnDate.String)
-			loan.ReturnDate = &parsedDate
-		}
-
 		loans = append(loans, loan)
 	}
-	c.JSON(http.StatusOK, loans)
+	c.JSON(http.StatusOK, newPage(q, loans, total))
 }
 
 // CreateLoan godoc
 // @Summary Create a new loan
-// @Description Add a new loan to the database
+// @Description Check a copy of a book out to a user. Without user_id the book is checked out to the authenticated user. With copy_id, for instance the copy whose barcode was scanned at the desk, that copy is lent and book_id is taken from it; otherwise the copy held for the user or the first available copy is lent. The user must pass the borrowing eligibility check; otherwise every reason for the refusal is listed. The due date is set from the configured loan period. The book row is locked for the duration of the checkout and the loan is refused if no copy is available.
 // @Tags loans
 // @Accept  json
 // @Produce  json
 // @Param loan body models.Loan true "Create Loan"
-// @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Success 201 {object} models.Loan
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /loans [post]
 func (h *LoanHandler) CreateLoan(c *gin.Context) {
 	var loan models.Loan
-	if err := c.BindJSON(&loan); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&loan); err != nil {
+		writeBindError(c, err)
 		return
 	}
+	loan.UserID = actingUserID(c, loan.UserID, models.RoleLibrarian)
 
-	stmt, err := h.DB.Prepare("INSERT INTO Loans (BookID, UserID, LoanDate, ReturnDate) VALUES (?, ?, ?, ?)")
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
-	_, err = stmt.Exec(loan.BookID, loan.UserID, loan.LoanDate.Format("2006-01-02"), loan.ReturnDate.Format("2006-01-02"))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := checkoutBook(tx, h.Policy, &loan); err != nil {
+		writeCheckoutError(c, err)
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"message": "Loan created"})
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, loan)
+}
+
+// Checkout failures that are reported to the client rather than as server
+// errors.
+var (
+	errUserNotFound    = errors.New("User not found")
+	errBookNotFound    = errors.New("Book not found")
+	errCopyNotFound    = errors.New("Copy not found")
+	errNoCopyAvailable = errors.New("No copy of the book is available")
+	errCopyUnavailable = errors.New("Copy is not available")
+)
+
+// ineligibleError reports a checkout refused by the eligibility check.
+type ineligibleError struct {
+	eligibility models.Eligibility
+}
+
+func (e *ineligibleError) Error() string {
+	return "User is not eligible to borrow"
+}
+
+// checkoutBook lends a copy of a book inside the caller's transaction. The
+// user row and then the book row are locked and the user must pass the
+// eligibility check. The copy is loan.CopyID when set, else the copy held for
+// the user, else the first available one; a copy on hold can only be taken by
+// the patron it is held for. On success the loan is filled in with its ID,
+// copy and dates.
+func checkoutBook(tx *sql.Tx, policy Policy, loan *models.Loan) error {
+	if loan.LoanDate == nil {
+		loanDate := today()
+		loan.LoanDate = &loanDate
+	}
+	dueDate := loan.LoanDate.AddDate(0, 0, policy.LoanPeriodDays)
+	loan.DueDate = &dueDate
+	loan.ReturnDate = nil
+	loan.RenewalCount = 0
+
+	// Locking the user row serialises concurrent checkouts for the same
+	// patron, so the loan limit cannot be exceeded by parallel requests.
+	var userID int
+	err := tx.QueryRow("SELECT UserID FROM Users WHERE UserID = ? FOR UPDATE", loan.UserID).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	eligibility, err := checkEligibility(tx, policy, loan.UserID)
+	if err != nil {
+		return err
+	}
+	if !eligibility.Eligible {
+		return &ineligibleError{eligibility: eligibility}
+	}
+
+	if loan.CopyID != 0 {
+		err = tx.QueryRow("SELECT BookID FROM Copies WHERE CopyID = ?", loan.CopyID).Scan(&loan.BookID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errCopyNotFound
+		}
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.QueryRow("SELECT BookID FROM Books WHERE BookID = ? FOR UPDATE", loan.BookID).Scan(&loan.BookID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errBookNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var reservationID int
+	var heldCopyID sql.NullInt64
+	err = tx.QueryRow("SELECT ReservationID, CopyID FROM Reservations WHERE BookID = ? AND UserID = ? AND Status = ? FOR UPDATE", loan.BookID, loan.UserID, models.ReservationReady).Scan(&reservationID, &heldCopyID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	hasHold := err == nil
+	if loan.CopyID == 0 && heldCopyID.Valid {
+		loan.CopyID = int(heldCopyID.Int64)
+	}
+
+	if loan.CopyID == 0 {
+		err = tx.QueryRow("SELECT CopyID FROM Copies WHERE BookID = ? AND Status = ? ORDER BY CopyID LIMIT 1 FOR UPDATE", loan.BookID, models.CopyAvailable).Scan(&loan.CopyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errNoCopyAvailable
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		// A copy held for pickup is unavailable to everyone except the
+		// patron whose reservation it is being held for.
+		var status string
+		if err := tx.QueryRow("SELECT Status FROM Copies WHERE CopyID = ? FOR UPDATE", loan.CopyID).Scan(&status); err != nil {
+			return err
+		}
+		heldForUser := heldCopyID.Valid && int(heldCopyID.Int64) == loan.CopyID
+		if status != models.CopyAvailable && !(status == models.CopyOnHold && heldForUser) {
+			return errCopyUnavailable
+		}
+	}
+
+	if hasHold {
+		if _, err := tx.Exec("UPDATE Reservations SET Status = ? WHERE ReservationID = ?", models.ReservationFulfilled, reservationID); err != nil {
+			return err
+		}
+		// A patron who takes another copy than the one held for them
+		// releases the held copy to the next patron in the queue.
+		if heldCopyID.Valid && int(heldCopyID.Int64) != loan.CopyID {
+			if _, err := promoteNextReservation(tx, policy, loan.BookID, int(heldCopyID.Int64)); err != nil {
+				return err
+			}
+		}
+	}
+
+	result, err := tx.Exec("INSERT INTO Loans (BookID, CopyID, UserID, LoanDate, DueDate) VALUES (?, ?, ?, ?, ?)", loan.BookID, loan.CopyID, loan.UserID, formatDate(loan.LoanDate), formatDate(loan.DueDate))
+	if err != nil {
+		return err
+	}
+	loanID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	loan.LoanID = int(loanID)
+	setOverdue(loan)
+	return nil
+}
+
+// Codes of the problems returned when a loan cannot be changed, returned or
+// renewed.
+const (
+	LoanCodeReturned    = "loan_returned"
+	RenewalCodeLimit    = "renewal_limit"
+	RenewalCodeOverdue  = "overdue"
+	RenewalCodeReserved = "reserved"
+)
+
+// Codes of the problems returned when a checkout is refused.
+const (
+	CheckoutCodeNoCopyAvailable = "no_copy_available"
+	CheckoutCodeCopyUnavailable = "copy_unavailable"
+	CheckoutCodeNotEligible     = "not_eligible"
+)
+
+// writeCheckoutError responds to a failed checkoutBook call. A patron who may
+// not borrow gets the reasons as the reasons member of the problem.
+func writeCheckoutError(c *gin.Context, err error) {
+	var ineligible *ineligibleError
+	switch {
+	case errors.Is(err, errUserNotFound), errors.Is(err, errBookNotFound), errors.Is(err, errCopyNotFound):
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, err.Error())
+	case errors.Is(err, errNoCopyAvailable):
+		writeProblem(c, http.StatusConflict, CheckoutCodeNoCopyAvailable, err.Error())
+	case errors.Is(err, errCopyUnavailable):
+		writeProblem(c, http.StatusConflict, CheckoutCodeCopyUnavailable, err.Error())
+	case errors.As(err, &ineligible):
+		problem := newProblem(http.StatusConflict, CheckoutCodeNotEligible, err.Error())
+		problem.Reasons = ineligible.eligibility.Reasons
+		sendProblem(c, problem)
+	default:
+		writeError(c, err)
+	}
 }
 
 // GetLoanByID godoc
@@ -101,66 +361,242 @@ func (h *LoanHandler) CreateLoan(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "Loan ID"
 // @Success 200 {object} models.Loan
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /loans/{id} [get]
 func (h *LoanHandler) GetLoanByID(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var loan models.Loan
-	var loanDate sql.NullString
-	var returnDate sql.NullString
-
-	err := h.DB.QueryRow("SELECT LoanID, BookID, UserID, LoanDate, ReturnDate FROM Loans WHERE LoanID = ?", id).Scan(&loan.LoanID, &loan.BookID, &loan.UserID, &loanDate, &returnDate)
+	err := scanLoan(h.DB.QueryRow("SELECT "+loanColumns+" FROM Loans WHERE LoanID = ?", id), &loan)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Loan not found"})
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Loan not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 		}
 		return
 	}
-
-	if loanDate.Valid {
-		parsedDate, _ := time.Parse("2006-01-02", loanDate.String)
-		loan.LoanDate = &parsedDate
-	}
-
-	if returnDate.Valid {
-		parsedDate, _ := time.Parse("2006-01-02", returnDate.String)
-		loan.ReturnDate = &parsedDate
+	if !authorizeOwner(c, loan.UserID, models.RoleLibrarian) {
+		return
 	}
-
 	c.JSON(http.StatusOK, loan)
 }
 
 // UpdateLoan godoc
 // @Summary Update a loan
-// @Description Update details of a loan given its ID
+// @Description Change the due date of an active loan given its ID; the loan keeps its due date when none is sent. The book, copy, patron and loan date cannot be changed, and a loan is returned only through POST /loans/{id}/return, which assesses fines and passes the copy on to the reservation queue.
 // @Tags loans
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Loan ID"
 // @Param loan body models.Loan true "Update Loan"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /loans/{id} [put]
 func (h *LoanHandler) UpdateLoan(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	var update models.Loan
+	if err := c.ShouldBindJSON(&update); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
 	var loan models.Loan
-	if err := c.BindJSON(&loan); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	err := scanLoan(h.DB.QueryRow("SELECT "+loanColumns+" FROM Loans WHERE LoanID = ?", id), &loan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Loan not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	if update.ReturnDate != nil && formatDate(update.ReturnDate) != formatDate(loan.ReturnDate) {
+		writeProblem(c, http.StatusConflict, ProblemCodeConflict, "Return the loan with POST /loans/{id}/return")
+		return
+	}
+	if update.DueDate == nil || formatDate(update.DueDate) == formatDate(loan.DueDate) {
+		c.JSON(http.StatusOK, gin.H{"message": "Loan updated"})
+		return
+	}
+	if loan.ReturnDate != nil {
+		writeProblem(c, http.StatusConflict, LoanCodeReturned, "Loan has already been returned")
+		return
+	}
+	if loan.LoanDate != nil && update.DueDate.Before(*loan.LoanDate) {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "due_date cannot be before the loan date")
 		return
 	}
 
-	_, err := h.DB.Exec("UPDATE Loans SET BookID = ?, UserID = ?, LoanDate = ?, ReturnDate = ? WHERE LoanID = ?", loan.BookID, loan.UserID, loan.LoanDate.Format("2006-01-02"), loan.ReturnDate.Format("2006-01-02"), id)
+	_, err = h.DB.Exec("UPDATE Loans SET DueDate = ? WHERE LoanID = ? AND ReturnDate IS NULL", formatDate(update.DueDate), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Loan updated"})
 }
 
+// ReturnLoan godoc
+// @Summary Return a loaned book
+// @Description Close a loan with today's date as the return date. A fine is assessed if the book is returned late. If the book has been reserved, the returned copy is held for pickup by the first patron in the queue instead of going back on the shelf.
+// @Tags loans
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Loan ID"
+// @Success 200 {object} models.LoanReturn
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /loans/{id}/return [post]
+func (h *LoanHandler) ReturnLoan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var loan models.Loan
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = scanLoan(tx.QueryRow("SELECT "+loanColumns+" FROM Loans WHERE LoanID = ? FOR UPDATE", id), &loan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Loan not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	if loan.ReturnDate != nil {
+		writeProblem(c, http.StatusConflict, LoanCodeReturned, "Loan has already been returned")
+		return
+	}
+
+	if err := tx.QueryRow("SELECT BookID FROM Books WHERE BookID = ? FOR UPDATE", loan.BookID).Scan(&loan.BookID); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	returnedOn := today()
+	loan.ReturnDate = &returnedOn
+	setOverdue(&loan)
+	if _, err := tx.Exec("UPDATE Loans SET ReturnDate = ? WHERE LoanID = ?", formatDate(loan.ReturnDate), loan.LoanID); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	result := models.LoanReturn{Loan: loan}
+	if loan.CopyID != 0 {
+		result.ReservationID, err = promoteNextReservation(tx, h.Policy, loan.BookID, loan.CopyID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+
+	result.Fine, err = assessFine(tx, h.Policy, loan)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RenewLoan godoc
+// @Summary Renew a loan
+// @Description Push the due date of an active loan forward by the loan period. Renewal is refused when the renewal limit is reached, when the loan is overdue past the grace period, or when other patrons are waiting in the book's reservation queue.
+// @Tags loans
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Loan ID"
+// @Success 200 {object} models.Loan
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /loans/{id}/renew [post]
+func (h *LoanHandler) RenewLoan(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var loan models.Loan
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	err = scanLoan(tx.QueryRow("SELECT "+loanColumns+" FROM Loans WHERE LoanID = ? FOR UPDATE", id), &loan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Loan not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	if loan.ReturnDate != nil {
+		writeProblem(c, http.StatusConflict, LoanCodeReturned, "Loan has already been returned")
+		return
+	}
+	if loan.RenewalCount >= h.Policy.MaxRenewals {
+		writeProblem(c, http.StatusConflict, RenewalCodeLimit, "Loan has reached the renewal limit")
+		return
+	}
+	if loan.DaysOverdue > h.Policy.RenewalGraceDays {
+		writeProblem(c, http.StatusConflict, RenewalCodeOverdue, "Loan is overdue past the grace period")
+		return
+	}
+
+	var reserved bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM Reservations r WHERE "+bookQueueFilter+" AND r.UserID <> ? AND r.Status = ?)", loan.BookID, loan.BookID, loan.UserID, models.ReservationWaiting).Scan(&reserved)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if reserved {
+		writeProblem(c, http.StatusConflict, RenewalCodeReserved, "Book has been reserved by another user")
+		return
+	}
+
+	dueDate := today()
+	if loan.DueDate != nil {
+		dueDate = *loan.DueDate
+	}
+	dueDate = dueDate.AddDate(0, 0, h.Policy.LoanPeriodDays)
+	loan.DueDate = &dueDate
+	loan.RenewalCount++
+	setOverdue(&loan)
+
+	if _, err := tx.Exec("UPDATE Loans SET DueDate = ?, RenewalCount = ? WHERE LoanID = ?", formatDate(loan.DueDate), loan.RenewalCount, loan.LoanID); err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, loan)
+}
+
 // DeleteLoan godoc
 // @Summary Delete a loan
 // @Description Delete a loan given its ID
@@ -169,13 +605,16 @@ func (h *LoanHandler) UpdateLoan(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "Loan ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /loans/{id} [delete]
 func (h *LoanHandler) DeleteLoan(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	_, err := h.DB.Exec("DELETE FROM Loans WHERE LoanID = ?", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Loan deleted"})
@@ -183,42 +622,83 @@ func (h *LoanHandler) DeleteLoan(c *gin.Context) {
 
 // GetUserLoanHistory godoc
 // @Summary Get user loan history
-// @Description Get the loan history of all users
+// @Description Get a page of the loan history of all users, most recent first, optionally for a single user
 // @Tags loans
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.UserLoanHistory
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: loan_date, due_date, return_date, user_name, book_title" default(-loan_date)
+// @Param user_id query int false "User ID"
+// @Success 200 {object} models.Page[models.UserLoanHistory]
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /loans/history [get]
 func (h *LoanHandler) GetUserLoanHistory(c *gin.Context) {
-	var histories []models.UserLoanHistory
-	rows, err := h.DB.Query("SELECT * FROM UserLoanHistory")
+	q := newListQuery(c, map[string]string{
+		"loan_date":   "LoanDate",
+		"due_date":    "DueDate",
+		"return_date": "ReturnDate",
+		"user_name":   "Name",
+		"book_title":  "Title",
+	}, "-loan_date")
+	q.filterInt("user_id", "UserID")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, "UserID, Name, Title, LoanDate, DueDate, ReturnDate", "UserLoanHistory")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
+	histories := []models.UserLoanHistory{}
 	for rows.Next() {
 		var history models.UserLoanHistory
-		var loanDate sql.NullString
-		var returnDate sql.NullString
+		var loanDate, dueDate, returnDate sql.NullString
 
-		if err := rows.Scan(&history.UserID, &history.UserName, &history.BookTitle, &loanDate, &returnDate); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := rows.Scan(&history.UserID, &history.UserName, &history.BookTitle, &loanDate, &dueDate, &returnDate); err != nil {
+			writeError(c, err)
 			return
 		}
-
-		if loanDate.Valid {
-			parsedDate, _ := time.Parse("2006-01-02", loanDate.String)
-			history.LoanDate = &parsedDate
-		}
-
-		if returnDate.Valid {
-			parsedDate, _ := time.Parse("2006-01-02", returnDate.String)
-			history.ReturnDate = &parsedDate
-		}
+		history.LoanDate = parseDate(loanDate)
+		history.DueDate = parseDate(dueDate)
+		history.ReturnDate = parseDate(returnDate)
 
 		histories = append(histories, history)
 	}
-	c.JSON(http.StatusOK, histories)
+	c.JSON(http.StatusOK, newPage(q, histories, total))
+}
+
+// GetMyLoans godoc
+// @Summary Get loans of the current user
+// @Description Get a page of the loans of the authenticated user, most recent first
+// @Tags me
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, loan_date, due_date, return_date" default(-loan_date)
+// @Param book_id query int false "Book ID"
+// @Param active query bool false "true for loans not yet returned, false for returned loans"
+// @Success 200 {object} models.Page[models.Loan]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /me/loans [get]
+func (h *LoanHandler) GetMyLoans(c *gin.Context) {
+	user, _ := CurrentUser(c)
+	q := newListQuery(c, loanSortFields, "-loan_date")
+	q.filter("UserID = ?", user.UserID)
+	q.filterInt("book_id", "BookID")
+	q.filterNull("active", "ReturnDate")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	writeLoans(c, h.DB, q)
 }
@@ -0,0 +1,40 @@
+package handlers
+
+// Policy holds the circulation rules applied by the handlers. The defaults
+// can be overridden at startup, see loadPolicy in main.go.
+type Policy struct {
+	// LoanPeriodDays is the number of days a book may be kept before it is due.
+	LoanPeriodDays int
+	// MaxRenewals is how many times a single loan may be renewed.
+	MaxRenewals int
+	// RenewalGraceDays is how many days past its due date a loan can still
+	// be renewed.
+	RenewalGraceDays int
+	// FineDailyRate is the fine charged for each day a book is returned late.
+	FineDailyRate float64
+	// FineCap is the largest fine charged for a single late item; zero
+	// means no cap.
+	FineCap float64
+	// MaxActiveLoans is how many books a user may have on loan at once.
+	MaxActiveLoans int
+	// MaxOutstandingFines is the unpaid fines balance above which a user may
+	// not borrow.
+	MaxOutstandingFines float64
+	// HoldPickupDays is how long a returned book is held for the patron at
+	// the head of its reservation queue.
+	HoldPickupDays int
+}
+
+// DefaultPolicy returns the circulation rules used when nothing is configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		LoanPeriodDays:      30,
+		MaxRenewals:         2,
+		RenewalGraceDays:    3,
+		FineDailyRate:       0.50,
+		FineCap:             20.00,
+		MaxActiveLoans:      5,
+		MaxOutstandingFines: 10.00,
+		HoldPickupDays:      7,
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Codes of the problems returned by the handlers. Problems about a single
+// rule, such as the reservation rules, have codes of their own.
+const (
+	ProblemCodeBadRequest       = "bad_request"
+	ProblemCodeInvalidQuery     = "invalid_query"
+	ProblemCodeUnauthorized     = "unauthorized"
+	ProblemCodeForbidden        = "forbidden"
+	ProblemCodeNotFound         = "not_found"
+	ProblemCodeConflict         = "conflict"
+	ProblemCodeTooLarge         = "too_large"
+	ProblemCodeDuplicate        = "duplicate"
+	ProblemCodeStillReferenced  = "still_referenced"
+	ProblemCodeUnknownReference = "unknown_reference"
+	ProblemCodeMissingValue     = "missing_value"
+	ProblemCodeValueTooLong     = "value_too_long"
+	ProblemCodeValueOutOfRange  = "value_out_of_range"
+	ProblemCodeInvalidValue     = "invalid_value"
+	ProblemCodeInternal         = "internal_error"
+)
+
+// problemContentType is the media type of RFC 7807 problem details.
+const problemContentType = "application/problem+json"
+
+// MariaDB error numbers translated by problemFor.
+const (
+	errDupEntry            = 1062
+	errBadNull             = 1048
+	errRowIsReferenced     = 1217
+	errNoReferencedRow     = 1216
+	errOutOfRange          = 1264
+	errDataTruncated       = 1265
+	errTruncatedWrongValue = 1366
+	errDataTooLong         = 1406
+	errRowIsReferenced2    = 1451
+	errNoReferencedRow2    = 1452
+	errCheckViolated       = 3819
+	errConstraintFailed    = 4025
+)
+
+var (
+	duplicateKeyPattern = regexp.MustCompile("for key '(?:[^'.]+\\.)?([^']+)'")
+	foreignKeyPattern   = regexp.MustCompile("fails \\(`[^`]+`\\.`([^`]+)`, CONSTRAINT `[^`]+` FOREIGN KEY \\(`([^`]+)`\\) REFERENCES `([^`]+)`")
+	columnPattern       = regexp.MustCompile("(?i)column (?:'([^']+)'|(?:`[^`]+`\\.)*`([^`]+)`)")
+)
+
+// problemFor translates an error into a problem. Constraint violations
+// reported by the database become 409 or 422 responses naming the field at
+// fault; any other error is an internal error, whose text is not shown to the
+// client.
+func problemFor(err error) models.Problem {
+	var dbErr *mysql.MySQLError
+	if !errors.As(err, &dbErr) {
+		return newProblem(http.StatusInternalServerError, ProblemCodeInternal, "The server could not complete the request")
+	}
+	switch dbErr.Number {
+	case errDupEntry:
+		key := "value"
+		if m := duplicateKeyPattern.FindStringSubmatch(dbErr.Message); m != nil {
+			key = fieldName(m[1])
+			if m[1] == "PRIMARY" {
+				key = "ID"
+			}
+		}
+		return newProblem(http.StatusConflict, ProblemCodeDuplicate, fmt.Sprintf("Another record already has this %s", key))
+	case errRowIsReferenced, errRowIsReferenced2:
+		detail := "The record is still referenced by other records; delete or reassign them first"
+		if m := foreignKeyPattern.FindStringSubmatch(dbErr.Message); m != nil {
+			detail = fmt.Sprintf("The record is still referenced by %s; delete or reassign them first", tableName(m[1]))
+		}
+		return newProblem(http.StatusConflict, ProblemCodeStillReferenced, detail)
+	case errNoReferencedRow, errNoReferencedRow2:
+		detail := "A referenced record does not exist"
+		if m := foreignKeyPattern.FindStringSubmatch(dbErr.Message); m != nil {
+			detail = fmt.Sprintf("%s does not refer to any of the %s", fieldName(m[2]), tableName(m[3]))
+		}
+		return newProblem(http.StatusUnprocessableEntity, ProblemCodeUnknownReference, detail)
+	case errBadNull:
+		return newProblem(http.StatusUnprocessableEntity, ProblemCodeMissingValue, columnName(dbErr.Message)+" is required")
+	case errDataTooLong:
+		return newProblem(http.StatusUnprocessableEntity, ProblemCodeValueTooLong, columnName(dbErr.Message)+" is too long")
+	case errOutOfRange:
+		return newProblem(http.StatusUnprocessableEntity, ProblemCodeValueOutOfRange, columnName(dbErr.Message)+" is out of range")
+	case errDataTruncated, errTruncatedWrongValue:
+		return newProblem(http.StatusUnprocessableEntity, ProblemCodeInvalidValue, columnName(dbErr.Message)+" is invalid")
+	case errCheckViolated, errConstraintFailed:
+		return newProblem(http.StatusUnprocessableEntity, ProblemCodeInvalidValue, "A value breaks a constraint of the record")
+	}
+	return newProblem(http.StatusInternalServerError, ProblemCodeInternal, "The server could not complete the request")
+}
+
+func newProblem(status int, code, detail string) models.Problem {
+	return models.Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail, Code: code}
+}
+
+// writeProblem responds with a problem of the given status, code and detail.
+// Every error response of the API goes through it or sendProblem.
+func writeProblem(c *gin.Context, status int, code, detail string) {
+	sendProblem(c, newProblem(status, code, detail))
+}
+
+// sendProblem sends a problem as application/problem+json and stops the
+// handler chain, so that it can also be used by middleware.
+func sendProblem(c *gin.Context, problem models.Problem) {
+	problem.Instance = c.Request.URL.Path
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// writeError responds to an error not handled by the caller with the problem
+// problemFor makes of it.
+func writeError(c *gin.Context, err error) {
+	sendProblem(c, requestProblem(c, err))
+}
+
+// requestProblem is problemFor for an error of the current request. Internal
+// errors are recorded on the context, where the request logger picks them up.
+func requestProblem(c *gin.Context, err error) models.Problem {
+	problem := problemFor(err)
+	if problem.Status == http.StatusInternalServerError {
+		c.Error(err)
+	}
+	return problem
+}
+
+// errorDetail describes an error for a report: a database error as its
+// problem detail, any other error by its own text.
+func errorDetail(err error) string {
+	var dbErr *mysql.MySQLError
+	if errors.As(err, &dbErr) {
+		return problemFor(err).Detail
+	}
+	return err.Error()
+}
+
+// columnName returns the JSON field name of the column a database error
+// message is about.
+func columnName(message string) string {
+	m := columnPattern.FindStringSubmatch(message)
+	if m == nil {
+		return "A value"
+	}
+	return fieldName(m[1] + m[2])
+}
+
+// tableName describes the records of a table for a problem detail. The rows
+// of the tables linking books to authors and categories stand for books.
+func tableName(table string) string {
+	switch table {
+	case "BookAuthors", "BookCategories":
+		return "books"
+	}
+	return strings.ReplaceAll(fieldName(table), "_", " ")
+}
+
+// fieldName turns a column name, such as PublisherID, into the name of its
+// JSON field, publisher_id.
+func fieldName(column string) string {
+	runes := []rune(column)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
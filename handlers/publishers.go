@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type PublisherHandler struct {
+	DB *sql.DB
+}
+
+func NewPublisherHandler(db *sql.DB) *PublisherHandler {
+	return &PublisherHandler{DB: db}
+}
+
+// GetPublishers godoc
+// @Summary Get a list of publishers
+// @Description Get a page of publishers, optionally filtered by a fragment of the name
+// @Tags publishers
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, name" default(id)
+// @Param name query string false "Fragment of the name"
+// @Success 200 {object} models.Page[models.Publisher]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /publishers [get]
+func (h *PublisherHandler) GetPublishers(c *gin.Context) {
+	q := newListQuery(c, map[string]string{"id": "PublisherID", "name": "Name"}, "id")
+	q.filterContains("name", "Name")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, "PublisherID, Name, Address", "Publishers")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	publishers := []models.Publisher{}
+	for rows.Next() {
+		var publisher models.Publisher
+		if err := rows.Scan(&publisher.PublisherID, &publisher.Name, &publisher.Address); err != nil {
+			writeError(c, err)
+			return
+		}
+		publishers = append(publishers, publisher)
+	}
+	c.JSON(http.StatusOK, newPage(q, publishers, total))
+}
+
+// CreatePublisher godoc
+// @Summary Create a new publisher
+// @Description Add a new publisher to the database
+// @Tags publishers
+// @Accept  json
+// @Produce  json
+// @Param publisher body models.Publisher true "Create Publisher"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /publishers [post]
+func (h *PublisherHandler) CreatePublisher(c *gin.Context) {
+	var publisher models.Publisher
+	if err := c.ShouldBindJSON(&publisher); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	stmt, err := h.DB.Prepare("INSERT INTO Publishers (Name, Address) VALUES (?, ?)")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(publisher.Name, publisher.Address)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Publisher created"})
+}
+
+// GetPublisherByID godoc
+// @Summary Get details of a specific publisher
+// @Description Get details of a publisher given its ID
+// @Tags publishers
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Publisher ID"
+// @Success 200 {object} models.Publisher
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /publishers/{id} [get]
+func (h *PublisherHandler) GetPublisherByID(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var publisher models.Publisher
+	err := h.DB.QueryRow("SELECT PublisherID, Name, Address FROM Publishers WHERE PublisherID = ?", id).Scan(&publisher.PublisherID, &publisher.Name, &publisher.Address)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Publisher not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, publisher)
+}
+
+// UpdatePublisher godoc
+// @Summary Update a publisher
+// @Description Update details of a publisher given its ID
+// @Tags publishers
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Publisher ID"
+// @Param publisher body models.Publisher true "Update Publisher"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /publishers/{id} [put]
+func (h *PublisherHandler) UpdatePublisher(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var publisher models.Publisher
+	if err := c.ShouldBindJSON(&publisher); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	_, err := h.DB.Exec("UPDATE Publishers SET Name = ?, Address = ? WHERE PublisherID = ?", publisher.Name, publisher.Address, id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Publisher updated"})
+}
+
+// DeletePublisher godoc
+// @Summary Delete a publisher
+// @Description Delete a publisher given its ID
+// @Tags publishers
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Publisher ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /publishers/{id} [delete]
+func (h *PublisherHandler) DeletePublisher(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	_, err := h.DB.Exec("DELETE FROM Publishers WHERE PublisherID = ?", id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Publisher deleted"})
+}
+
+// GetPublisherBooks godoc
+// @Summary Get books of a publisher
+// @Description Get a page of the books released by a publisher given its ID
+// @Tags publishers
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Publisher ID"
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, title, available_copies, publication_year, call_number" default(id)
+// @Success 200 {object} models.Page[models.Book]
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /publishers/{id}/books [get]
+func (h *PublisherHandler) GetPublisherBooks(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	q := newListQuery(c, bookSortFields, "id")
+	q.filter("PublisherID = ?", id)
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Publishers WHERE PublisherID = ?)", id).Scan(&exists); err != nil {
+		writeError(c, err)
+		return
+	}
+	if !exists {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Publisher not found")
+		return
+	}
+
+	total, rows, err := q.query(h.DB, bookColumns, "BookAvailability")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	books := []models.Book{}
+	for rows.Next() {
+		var book models.Book
+		if err := scanBook(rows, &book); err != nil {
+			writeError(c, err)
+			return
+		}
+		books = append(books, book)
+	}
+	if err := loadBookLinks(h.DB, books); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newPage(q, books, total))
+}
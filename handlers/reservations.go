@@ -2,109 +2,506 @@ package handlers
 
 import (
 	"books_rent/models"
+	"context"
 	"database/sql"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 )
 
 type ReservationHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Policy Policy
 }
 
-func NewReservationHandler(db *sql.DB) *ReservationHandler {
-	return &ReservationHandler{DB: db}
+func NewReservationHandler(db *sql.DB, policy Policy) *ReservationHandler {
+	return &ReservationHandler{DB: db, Policy: policy}
+}
+
+// reservationColumns lists the Reservations columns, selected from the table
+// aliased as r, in the order expected by scanReservation. The last column is
+// the position of a waiting reservation in its FIFO queue: a reservation on a
+// book waits behind the earlier ones on the book and on its work, and one on a
+// work behind the earlier ones on the work.
+const reservationColumns = "r.ReservationID, r.BookID, r.WorkID, r.UserID, r.ReservationDate, r.Status, r.HoldUntil, r.CopyID, " +
+	"CASE WHEN r.Status = 'waiting' THEN (SELECT COUNT(*) FROM Reservations q WHERE q.Status = 'waiting' AND q.ReservationID <= r.ReservationID " +
+	"AND (q.BookID = r.BookID OR (q.BookID IS NULL AND q.WorkID = COALESCE(r.WorkID, (SELECT b.WorkID FROM Books b WHERE b.BookID = r.BookID))))) ELSE 0 END"
+
+// bookQueueFilter keeps the reservations in the queue of a book, given twice:
+// those on the book itself and the waiting ones on its work.
+const bookQueueFilter = "(r.BookID = ? OR (r.BookID IS NULL AND r.WorkID = (SELECT b.WorkID FROM Books b WHERE b.BookID = ?)))"
+
+// reservationSortFields are the fields reservations can be sorted by.
+var reservationSortFields = map[string]string{"id": "r.ReservationID", "reservation_date": "r.ReservationDate", "status": "r.Status"}
+
+func scanReservation(row rowScanner, reservation *models.Reservation) error {
+	var reservationDate, holdUntil sql.NullString
+	var bookID, workID, copyID sql.NullInt64
+	if err := row.Scan(&reservation.ReservationID, &bookID, &workID, &reservation.UserID, &reservationDate, &reservation.Status, &holdUntil, &copyID, &reservation.QueuePosition); err != nil {
+		return err
+	}
+	reservation.BookID = int(bookID.Int64)
+	reservation.WorkID, reservation.CopyID = nil, nil
+	if workID.Valid {
+		id := int(workID.Int64)
+		reservation.WorkID = &id
+	}
+	if copyID.Valid {
+		id := int(copyID.Int64)
+		reservation.CopyID = &id
+	}
+	if date := parseDate(reservationDate); date != nil {
+		reservation.ReservationDate = *date
+	}
+	reservation.HoldUntil = parseDate(holdUntil)
+	return nil
+}
+
+// promoteNextReservation hands a copy of a book that has just become free to
+// the head of the book's reservation queue, holding it for pickup for the
+// configured number of days. The queue includes the reservations on the
+// book's work, which take the book as their edition when they are promoted.
+// The copy is on hold while it is held and goes back on the shelf when nobody
+// is waiting. The caller must hold a lock on the book row.
+func promoteNextReservation(tx *sql.Tx, policy Policy, bookID, copyID int) (*int, error) {
+	var reservationID int
+	err := tx.QueryRow("SELECT r.ReservationID FROM Reservations r WHERE "+bookQueueFilter+" AND r.Status = ? ORDER BY r.ReservationID LIMIT 1 FOR UPDATE", bookID, bookID, models.ReservationWaiting).Scan(&reservationID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	held := err == nil
+
+	if held {
+		holdUntil := today().AddDate(0, 0, policy.HoldPickupDays)
+		if _, err := tx.Exec("UPDATE Reservations SET Status = ?, HoldUntil = ?, CopyID = ?, BookID = ? WHERE ReservationID = ?", models.ReservationReady, formatDate(&holdUntil), copyID, bookID, reservationID); err != nil {
+			return nil, err
+		}
+	}
+	status := models.CopyAvailable
+	if held {
+		status = models.CopyOnHold
+	}
+	if _, err := tx.Exec("UPDATE Copies SET Status = ? WHERE CopyID = ?", status, copyID); err != nil {
+		return nil, err
+	}
+	if !held {
+		return nil, nil
+	}
+	return &reservationID, nil
+}
+
+// ExpireHolds expires every pickup hold whose hold period has passed and
+// passes each held copy on to the next patron in its book's queue. It returns the number
+// of holds that were expired.
+func (h *ReservationHandler) ExpireHolds(ctx context.Context) (int, error) {
+	rows, err := h.DB.QueryContext(ctx, "SELECT ReservationID FROM Reservations WHERE Status = ? AND HoldUntil < ?", models.ReservationReady, today().Format(dateLayout))
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		ok, err := h.expireHold(ctx, id)
+		if err != nil {
+			return expired, err
+		}
+		if ok {
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// expireHold expires a single hold if it is still ready and past its hold
+// date by the time its book row is locked.
+func (h *ReservationHandler) expireHold(ctx context.Context, reservationID int) (bool, error) {
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var bookID int
+	if err := tx.QueryRow("SELECT BookID FROM Reservations WHERE ReservationID = ?", reservationID).Scan(&bookID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := tx.QueryRow("SELECT BookID FROM Books WHERE BookID = ? FOR UPDATE", bookID).Scan(&bookID); err != nil {
+		return false, err
+	}
+
+	var reservation models.Reservation
+	if err := scanReservation(tx.QueryRow("SELECT "+reservationColumns+" FROM Reservations r WHERE r.ReservationID = ? FOR UPDATE", reservationID), &reservation); err != nil {
+		return false, err
+	}
+	if reservation.Status != models.ReservationReady || reservation.HoldUntil == nil || !reservation.HoldUntil.Before(today()) {
+		return false, nil
+	}
+
+	if _, err := tx.Exec("UPDATE Reservations SET Status = ? WHERE ReservationID = ?", models.ReservationExpired, reservationID); err != nil {
+		return false, err
+	}
+	if reservation.CopyID != nil {
+		if _, err := promoteNextReservation(tx, h.Policy, bookID, *reservation.CopyID); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// RunHoldExpiry calls ExpireHolds right away, to release holds that lapsed
+// while the server was down, and then every interval until the context is
+// done.
+func (h *ReservationHandler) RunHoldExpiry(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if expired, err := h.ExpireHolds(ctx); err != nil {
+			log.Printf("expiring reservation holds: %v", err)
+		} else if expired > 0 {
+			log.Printf("expired %d reservation holds", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 // GetReservations godoc
 // @Summary Get a list of reservations
-// @Description Get a list of all reservations
+// @Description Get a page of reservations, optionally filtered by user, book, work or status
 // @Tags reservations
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Reservation
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, reservation_date, status" default(id)
+// @Param user_id query int false "User ID"
+// @Param book_id query int false "Book ID"
+// @Param work_id query int false "Work ID, for the reservations placed on a work"
+// @Param status query string false "Status" Enums(waiting, ready, fulfilled, expired)
+// @Success 200 {object} models.Page[models.Reservation]
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reservations [get]
 func (h *ReservationHandler) GetReservations(c *gin.Context) {
-	var reservations []models.Reservation
-	rows, err := h.DB.Query("SELECT * FROM Reservations")
+	q := newListQuery(c, reservationSortFields, "id")
+	q.filterInt("user_id", "r.UserID")
+	q.filterInt("book_id", "r.BookID")
+	q.filterInt("work_id", "r.WorkID")
+	q.filterString("status", "r.Status")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	h.writeReservations(c, q)
+}
+
+// writeReservations responds with the page of reservations selected by q.
+func (h *ReservationHandler) writeReservations(c *gin.Context, q *listQuery) {
+	total, rows, err := q.query(h.DB, reservationColumns, "Reservations r")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	reservations := []models.Reservation{}
+	for rows.Next() {
+		var reservation models.Reservation
+		if err := scanReservation(rows, &reservation); err != nil {
+			writeError(c, err)
+			return
+		}
+		reservations = append(reservations, reservation)
+	}
+	c.JSON(http.StatusOK, newPage(q, reservations, total))
+}
+
+// GetBookReservationQueue godoc
+// @Summary Get the reservation queue of a book
+// @Description Get the pickup hold and the waiting reservations of a book in queue order, including the waiting reservations on the book's work
+// @Tags reservations
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Book ID"
+// @Success 200 {array} models.Reservation
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /books/{id}/reservations [get]
+func (h *ReservationHandler) GetBookReservationQueue(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	reservations := []models.Reservation{}
+	rows, err := h.DB.Query("SELECT "+reservationColumns+" FROM Reservations r WHERE "+bookQueueFilter+" AND r.Status IN (?, ?) ORDER BY r.Status = ? DESC, r.ReservationID", id, id, models.ReservationReady, models.ReservationWaiting, models.ReservationReady)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var reservation models.Reservation
-		var reservationDate string // handling date as a string for simplicity
-		if err := rows.Scan(&reservation.ReservationID, &reservation.BookID, &reservation.UserID, &reservationDate); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if err := scanReservation(rows, &reservation); err != nil {
+			writeError(c, err)
 			return
 		}
-		reservation.ReservationDate, _ = time.Parse("2006-01-02", reservationDate)
 		reservations = append(reservations, reservation)
 	}
 	c.JSON(http.StatusOK, reservations)
 }
 
+// Codes of the reservation rules, returned as the problem code when a
+// reservation is refused.
+const (
+	ReservationCodeAlreadyOnLoan = "already_on_loan"
+	ReservationCodeDuplicate     = "duplicate_reservation"
+	ReservationCodeBookAvailable = "book_available"
+)
+
+// reservationTarget is what a reservation is placed on: a single book, or a
+// work, any edition of which fulfils the reservation. books selects its books
+// by their BookID column, and reservations selects the open reservations that
+// cover any of them; each takes the ID of the book or work once per
+// placeholder.
+type reservationTarget struct {
+	name         string
+	notFound     string
+	id           int
+	books        string
+	reservations string
+}
+
+func bookReservationTarget(bookID int) reservationTarget {
+	return reservationTarget{
+		name:         "book",
+		notFound:     "Book not found",
+		id:           bookID,
+		books:        "BookID = ?",
+		reservations: "(BookID = ? OR WorkID = (SELECT WorkID FROM Books WHERE BookID = ?))",
+	}
+}
+
+func workReservationTarget(workID int) reservationTarget {
+	return reservationTarget{
+		name:         "work",
+		notFound:     "Work not found",
+		id:           workID,
+		books:        "BookID IN (SELECT BookID FROM Books WHERE WorkID = ?)",
+		reservations: "(WorkID = ? OR BookID IN (SELECT BookID FROM Books WHERE WorkID = ?))",
+	}
+}
+
+// lock locks the rows of the target's books, in ID order, so that no copy of
+// them is returned while the reservation is checked. It returns
+// sql.ErrNoRows when the book or work does not exist.
+func (t reservationTarget) lock(tx *sql.Tx) error {
+	if t.name == "book" {
+		return tx.QueryRow("SELECT BookID FROM Books WHERE BookID = ? FOR UPDATE", t.id).Scan(&t.id)
+	}
+	if err := tx.QueryRow("SELECT WorkID FROM Works WHERE WorkID = ?", t.id).Scan(&t.id); err != nil {
+		return err
+	}
+	rows, err := tx.Query("SELECT BookID FROM Books WHERE WorkID = ? ORDER BY BookID FOR UPDATE", t.id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bookID int
+		if err := rows.Scan(&bookID); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 // CreateReservation godoc
 // @Summary Create a new reservation
-// @Description Add a new reservation to the database
+// @Description Add a reservation to the end of the book's queue. The reservation date is set to today. The reservation is made for the authenticated user; only librarians may set user_id to reserve on behalf of someone else. A reservation is refused when the user already has the book on loan, already has an open reservation for it, or when a copy of the book is on the shelf. With loan_if_available set, a librarian's request for a book with a copy on the shelf checks that copy out to the user instead; patrons get 403, as only librarians check books out. A reservation may be placed on a work, with work_id instead of book_id, to take the first copy of any of its editions; the rules above then apply to all its editions.
 // @Tags reservations
 // @Accept  json
 // @Produce  json
 // @Param reservation body models.Reservation true "Create Reservation"
+// @Param loan_if_available query bool false "Check the book out immediately if it is on the shelf (librarians only)"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reservations [post]
 func (h *ReservationHandler) CreateReservation(c *gin.Context) {
 	var reservation models.Reservation
-	if err := c.BindJSON(&reservation); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&reservation); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	reservation.UserID = actingUserID(c, reservation.UserID, models.RoleLibrarian)
+	reservation.ReservationDate = today()
+	loanIfAvailable, _ := strconv.ParseBool(c.Query("loan_if_available"))
+	if user, _ := CurrentUser(c); loanIfAvailable && !hasRole(user, models.RoleLibrarian) {
+		writeProblem(c, http.StatusForbidden, ProblemCodeForbidden, "Only librarians can check books out")
+		return
+	}
+
+	if reservation.WorkID != nil && *reservation.WorkID == 0 {
+		reservation.WorkID = nil
+	}
+	target := bookReservationTarget(reservation.BookID)
+	if reservation.WorkID != nil {
+		if reservation.BookID != 0 {
+			writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "Reserve either a book or a work, not both")
+			return
+		}
+		target = workReservationTarget(*reservation.WorkID)
+	}
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
+	if err != nil {
+		writeError(c, err)
 		return
 	}
+	defer tx.Rollback()
 
-	stmt, err := h.DB.Prepare("INSERT INTO Reservations (BookID, UserID, ReservationDate) VALUES (?, ?, ?)")
+	// Locks are taken user first, then book, as checkoutBook does.
+	var userID int
+	err = tx.QueryRow("SELECT UserID FROM Users WHERE UserID = ? FOR UPDATE", reservation.UserID).Scan(&userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "User not found")
+		} else {
+			writeError(c, err)
+		}
 		return
 	}
-	defer stmt.Close()
+	if err := target.lock(tx); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, target.notFound)
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+	var availableBookID int
+	err = tx.QueryRow("SELECT BookID FROM Copies WHERE "+target.books+" AND Status = ? ORDER BY CopyID LIMIT 1", target.id, models.CopyAvailable).Scan(&availableBookID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(c, err)
+		return
+	}
+	available := err == nil
 
-	_, err = stmt.Exec(reservation.BookID, reservation.UserID, reservation.ReservationDate.Format("2006-01-02"))
+	var onLoan bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM Loans WHERE "+target.books+" AND UserID = ? AND ReturnDate IS NULL)", target.id, reservation.UserID).Scan(&onLoan)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
-	c.JSON(http.StatusCreated, gin.H{"message": "Reservation created"})
+	if onLoan {
+		writeProblem(c, http.StatusConflict, ReservationCodeAlreadyOnLoan, "User already has this "+target.name+" on loan")
+		return
+	}
+
+	var duplicate bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM Reservations WHERE "+target.reservations+" AND UserID = ? AND Status IN (?, ?))", target.id, target.id, reservation.UserID, models.ReservationWaiting, models.ReservationReady).Scan(&duplicate)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if duplicate {
+		writeProblem(c, http.StatusConflict, ReservationCodeDuplicate, "User has already reserved this "+target.name)
+		return
+	}
+
+	if available {
+		if !loanIfAvailable {
+			writeProblem(c, http.StatusConflict, ReservationCodeBookAvailable, "A copy of the "+target.name+" is on the shelf and can be borrowed now")
+			return
+		}
+		loan := models.Loan{BookID: availableBookID, UserID: reservation.UserID}
+		if err := checkoutBook(tx, h.Policy, &loan); err != nil {
+			writeCheckoutError(c, err)
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			writeError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Book is available, loan created instead", "loan": loan})
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO Reservations (BookID, WorkID, UserID, ReservationDate, Status) VALUES (?, ?, ?, ?, ?)", nullID(reservation.BookID), reservation.WorkID, reservation.UserID, reservation.ReservationDate.Format(dateLayout), models.ReservationWaiting)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	reservationID, err := result.LastInsertId()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Reservation created", "reservation_id": reservationID})
 }
 
 // GetReservationByID godoc
 // @Summary Get details of a specific reservation
-// @Description Get details of a reservation given its ID
+// @Description Get details of a reservation given its ID, including its position in the book's queue while it is waiting
 // @Tags reservations
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Reservation ID"
 // @Success 200 {object} models.Reservation
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reservations/{id} [get]
 func (h *ReservationHandler) GetReservationByID(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var reservation models.Reservation
-	var reservationDate string
-	err := h.DB.QueryRow("SELECT * FROM Reservations WHERE ReservationID = ?", id).Scan(&reservation.ReservationID, &reservation.BookID, &reservation.UserID, &reservationDate)
+	err := scanReservation(h.DB.QueryRow("SELECT "+reservationColumns+" FROM Reservations r WHERE r.ReservationID = ?", id), &reservation)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Reservation not found"})
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Reservation not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 		}
 		return
 	}
-	reservation.ReservationDate, _ = time.Parse("2006-01-02", reservationDate)
+	if !authorizeOwner(c, reservation.UserID, models.RoleLibrarian) {
+		return
+	}
 	c.JSON(http.StatusOK, reservation)
 }
 
@@ -117,20 +514,23 @@ func (h *ReservationHandler) GetReservationByID(c *gin.Context) {
 // @Param id path int true "Reservation ID"
 // @Param reservation body models.Reservation true "Update Reservation"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reservations/{id} [put]
 func (h *ReservationHandler) UpdateReservation(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var reservation models.Reservation
-	if err := c.BindJSON(&reservation); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&reservation); err != nil {
+		writeBindError(c, err)
 		return
 	}
 
-	_, err := h.DB.Exec("UPDATE Reservations SET BookID = ?, UserID = ?, ReservationDate = ? WHERE ReservationID = ?", reservation.BookID, reservation.UserID, reservation.ReservationDate.Format("2006-01-02"), id)
+	_, err := h.DB.Exec("UPDATE Reservations SET BookID = ?, WorkID = ?, UserID = ?, ReservationDate = ? WHERE ReservationID = ?", nullID(reservation.BookID), reservation.WorkID, reservation.UserID, reservation.ReservationDate.Format("2006-01-02"), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Reservation updated"})
@@ -138,20 +538,93 @@ func (h *ReservationHandler) UpdateReservation(c *gin.Context) {
 
 // DeleteReservation godoc
 // @Summary Delete a reservation
-// @Description Delete a reservation given its ID
+// @Description Delete a reservation given its ID. If a copy was being held for it, the copy passes to the next patron in the queue.
 // @Tags reservations
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Reservation ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reservations/{id} [delete]
 func (h *ReservationHandler) DeleteReservation(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	_, err := h.DB.Exec("DELETE FROM Reservations WHERE ReservationID = ?", id)
+
+	tx, err := h.DB.BeginTx(c.Request.Context(), nil)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
+		return
+	}
+	defer tx.Rollback()
+
+	// The book row is locked before the reservation is re-read, in the same
+	// order as returns and checkouts take their locks. A reservation on a work
+	// has no book until a copy is held for it.
+	var ownerID int
+	var bookID, copyID sql.NullInt64
+	var status string
+	err = tx.QueryRow("SELECT BookID, UserID FROM Reservations WHERE ReservationID = ?", id).Scan(&bookID, &ownerID)
+	if err == nil && !authorizeOwner(c, ownerID, models.RoleLibrarian) {
+		return
+	}
+	if err == nil && bookID.Valid {
+		err = tx.QueryRow("SELECT BookID FROM Books WHERE BookID = ? FOR UPDATE", bookID.Int64).Scan(&bookID)
+	}
+	if err == nil {
+		err = tx.QueryRow("SELECT Status, CopyID FROM Reservations WHERE ReservationID = ? FOR UPDATE", id).Scan(&status, &copyID)
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(c, err)
+		return
+	}
+	held := err == nil && status == models.ReservationReady && copyID.Valid
+
+	if _, err := tx.Exec("DELETE FROM Reservations WHERE ReservationID = ?", id); err != nil {
+		writeError(c, err)
+		return
+	}
+	if held {
+		if _, err := promoteNextReservation(tx, h.Policy, int(bookID.Int64), int(copyID.Int64)); err != nil {
+			writeError(c, err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Reservation deleted"})
 }
+
+// GetMyReservations godoc
+// @Summary Get reservations of the current user
+// @Description Get a page of the reservations of the authenticated user, most recent first, with the queue position of those still waiting
+// @Tags me
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, reservation_date, status" default(-id)
+// @Param book_id query int false "Book ID"
+// @Param work_id query int false "Work ID, for the reservations placed on a work"
+// @Param status query string false "Status" Enums(waiting, ready, fulfilled, expired)
+// @Success 200 {object} models.Page[models.Reservation]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /me/reservations [get]
+func (h *ReservationHandler) GetMyReservations(c *gin.Context) {
+	user, _ := CurrentUser(c)
+	q := newListQuery(c, reservationSortFields, "-id")
+	q.filter("r.UserID = ?", user.UserID)
+	q.filterInt("book_id", "r.BookID")
+	q.filterInt("work_id", "r.WorkID")
+	q.filterString("status", "r.Status")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	h.writeReservations(c, q)
+}
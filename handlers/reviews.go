@@ -3,6 +3,7 @@ package handlers
 import (
 	"books_rent/models"
 	"database/sql"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
@@ -16,62 +17,107 @@ func NewReviewHandler(db *sql.DB) *ReviewHandler {
 	return &ReviewHandler{DB: db}
 }
 
+// reviewSortFields are the fields reviews can be sorted by.
+var reviewSortFields = map[string]string{"id": "ReviewID", "rating": "Rating"}
+
+// reviewOwner returns the ID of the user who wrote a review. It responds 404
+// or 500 itself and returns false when the owner cannot be determined.
+func (h *ReviewHandler) reviewOwner(c *gin.Context, id int) (int, bool) {
+	var ownerID int
+	err := h.DB.QueryRow("SELECT UserID FROM Reviews WHERE ReviewID = ?", id).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Review not found")
+		} else {
+			writeError(c, err)
+		}
+		return 0, false
+	}
+	return ownerID, true
+}
+
 // GetReviews godoc
 // @Summary Get a list of reviews
-// @Description Get a list of all reviews
+// @Description Get a page of reviews, optionally filtered by book, user or rating
 // @Tags reviews
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.Review
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, rating" default(id)
+// @Param book_id query int false "Book ID"
+// @Param user_id query int false "User ID"
+// @Param rating query int false "Rating"
+// @Success 200 {object} models.Page[models.Review]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reviews [get]
 func (h *ReviewHandler) GetReviews(c *gin.Context) {
-	var reviews []models.Review
-	rows, err := h.DB.Query("SELECT * FROM Reviews")
+	q := newListQuery(c, reviewSortFields, "id")
+	q.filterInt("book_id", "BookID")
+	q.filterInt("user_id", "UserID")
+	q.filterInt("rating", "Rating")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	h.writeReviews(c, q)
+}
+
+// writeReviews responds with the page of reviews selected by q.
+func (h *ReviewHandler) writeReviews(c *gin.Context, q *listQuery) {
+	total, rows, err := q.query(h.DB, "ReviewID, BookID, UserID, Rating, Comment", "Reviews")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
+	reviews := []models.Review{}
 	for rows.Next() {
 		var review models.Review
 		if err := rows.Scan(&review.ReviewID, &review.BookID, &review.UserID, &review.Rating, &review.Comment); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 			return
 		}
 		reviews = append(reviews, review)
 	}
-	c.JSON(http.StatusOK, reviews)
+	c.JSON(http.StatusOK, newPage(q, reviews, total))
 }
 
 // CreateReview godoc
 // @Summary Create a new review
-// @Description Add a new review to the database
+// @Description Add a new review to the database. The review is written by the authenticated user; only librarians may set user_id to post on behalf of someone else.
 // @Tags reviews
 // @Accept  json
 // @Produce  json
 // @Param review body models.Review true "Create Review"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reviews [post]
 func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	var review models.Review
-	if err := c.BindJSON(&review); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&review); err != nil {
+		writeBindError(c, err)
 		return
 	}
 
+	review.UserID = actingUserID(c, review.UserID, models.RoleLibrarian)
+
 	stmt, err := h.DB.Prepare("INSERT INTO Reviews (BookID, UserID, Rating, Comment) VALUES (?, ?, ?, ?)")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer stmt.Close()
 
 	_, err = stmt.Exec(review.BookID, review.UserID, review.Rating, review.Comment)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, gin.H{"message": "Review created"})
@@ -85,8 +131,9 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "Review ID"
 // @Success 200 {object} models.Review
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reviews/{id} [get]
 func (h *ReviewHandler) GetReviewByID(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
@@ -94,9 +141,9 @@ func (h *ReviewHandler) GetReviewByID(c *gin.Context) {
 	err := h.DB.QueryRow("SELECT * FROM Reviews WHERE ReviewID = ?", id).Scan(&review.ReviewID, &review.BookID, &review.UserID, &review.Rating, &review.Comment)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Review not found"})
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Review not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 		}
 		return
 	}
@@ -105,27 +152,40 @@ func (h *ReviewHandler) GetReviewByID(c *gin.Context) {
 
 // UpdateReview godoc
 // @Summary Update a review
-// @Description Update details of a review given its ID
+// @Description Update details of a review given its ID. Patrons can only update their own reviews. The review keeps its author unless a librarian sends another user_id.
 // @Tags reviews
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Review ID"
 // @Param review body models.Review true "Update Review"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reviews/{id} [put]
 func (h *ReviewHandler) UpdateReview(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var review models.Review
-	if err := c.BindJSON(&review); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&review); err != nil {
+		writeBindError(c, err)
 		return
 	}
 
+	ownerID, ok := h.reviewOwner(c, id)
+	if !ok || !authorizeOwner(c, ownerID, models.RoleLibrarian) {
+		return
+	}
+	// The review keeps its author unless a librarian names another user.
+	if user, _ := CurrentUser(c); review.UserID == 0 || !hasRole(user, models.RoleLibrarian) {
+		review.UserID = ownerID
+	}
+
 	_, err := h.DB.Exec("UPDATE Reviews SET BookID = ?, UserID = ?, Rating = ?, Comment = ? WHERE ReviewID = ?", review.BookID, review.UserID, review.Rating, review.Comment, id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Review updated"})
@@ -133,20 +193,55 @@ func (h *ReviewHandler) UpdateReview(c *gin.Context) {
 
 // DeleteReview godoc
 // @Summary Delete a review
-// @Description Delete a review given its ID
+// @Description Delete a review given its ID. Patrons can only delete their own reviews.
 // @Tags reviews
 // @Accept  json
 // @Produce  json
 // @Param id path int true "Review ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /reviews/{id} [delete]
 func (h *ReviewHandler) DeleteReview(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	ownerID, ok := h.reviewOwner(c, id)
+	if !ok || !authorizeOwner(c, ownerID, models.RoleAdmin) {
+		return
+	}
+
 	_, err := h.DB.Exec("DELETE FROM Reviews WHERE ReviewID = ?", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Review deleted"})
 }
+
+// GetMyReviews godoc
+// @Summary Get reviews of the current user
+// @Description Get a page of the reviews written by the authenticated user
+// @Tags me
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, rating" default(id)
+// @Param book_id query int false "Book ID"
+// @Success 200 {object} models.Page[models.Review]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /me/reviews [get]
+func (h *ReviewHandler) GetMyReviews(c *gin.Context) {
+	user, _ := CurrentUser(c)
+	q := newListQuery(c, reviewSortFields, "id")
+	q.filter("UserID = ?", user.UserID)
+	q.filterInt("book_id", "BookID")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	h.writeReviews(c, q)
+}
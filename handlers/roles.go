@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// roleRank orders the roles so that each one includes the permissions of the
+// roles below it.
+var roleRank = map[string]int{
+	models.RolePatron:    1,
+	models.RoleLibrarian: 2,
+	models.RoleAdmin:     3,
+}
+
+// validRole reports whether role is one of the known roles.
+func validRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// hasRole reports whether the user has the given role or a higher one.
+func hasRole(user models.User, role string) bool {
+	return roleRank[user.Role] >= roleRank[role]
+}
+
+// RequireRole is a middleware that only lets through users with at least the
+// given role. It must run after RequireAuth.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok {
+			writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Not authenticated")
+			return
+		}
+		if !hasRole(user, role) {
+			writeProblem(c, http.StatusForbidden, ProblemCodeForbidden, "Insufficient permissions")
+			return
+		}
+		c.Next()
+	}
+}
+
+// authorizeOwner allows a request that acts on a record owned by ownerID when
+// the caller is that user or has at least staffRole. Otherwise it responds
+// with 403 and returns false.
+func authorizeOwner(c *gin.Context, ownerID int, staffRole string) bool {
+	user, ok := CurrentUser(c)
+	if !ok {
+		writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Not authenticated")
+		return false
+	}
+	if user.UserID == ownerID || hasRole(user, staffRole) {
+		return true
+	}
+	writeProblem(c, http.StatusForbidden, ProblemCodeForbidden, "You can only access your own records")
+	return false
+}
+
+// actingUserID returns the user a request acts for. Staff with at least
+// staffRole may name another user in the request body and default to
+// themselves; everyone else always acts as the authenticated user, whatever
+// the body says.
+func actingUserID(c *gin.Context, requested int, staffRole string) int {
+	user, _ := CurrentUser(c)
+	if requested != 0 && hasRole(user, staffRole) {
+		return requested
+	}
+	return user.UserID
+}
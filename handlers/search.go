@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"books_rent/search"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type SearchHandler struct {
+	DB    *sql.DB
+	Index *search.Index
+}
+
+func NewSearchHandler(db *sql.DB, index *search.Index) *SearchHandler {
+	return &SearchHandler{DB: db, Index: index}
+}
+
+// Default and maximum number of suggestions returned by Autocomplete.
+const (
+	defaultSuggestions = 10
+	maxSuggestions     = 50
+)
+
+// LoadSearchIndex fills the index with every book, author, category and user.
+// It is run once at startup; afterwards the write handlers keep the index in
+// sync.
+func LoadSearchIndex(db *sql.DB, index *search.Index) error {
+	index.StartLoad()
+	defer index.FinishLoad()
+
+	rows, err := db.Query("SELECT AuthorID, Name, Biography FROM Authors")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var name, biography sql.NullString
+		if err := rows.Scan(&id, &name, &biography); err != nil {
+			rows.Close()
+			return err
+		}
+		index.PutAuthor(id, name.String, biography.String)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query("SELECT CategoryID, Name FROM Categories")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var name sql.NullString
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		index.PutCategory(id, name.String)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.Query("SELECT UserID, Name, Email FROM Users")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		var name, email sql.NullString
+		if err := rows.Scan(&id, &name, &email); err != nil {
+			rows.Close()
+			return err
+		}
+		index.PutUser(id, name.String, email.String)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	bookAuthors, err := loadBookIDLists(db, "SELECT DISTINCT BookID, AuthorID FROM BookAuthors")
+	if err != nil {
+		return err
+	}
+	bookSubjects, err := loadBookIDLists(db, "SELECT BookID, CategoryID FROM BookCategories ORDER BY BookID, Position")
+	if err != nil {
+		return err
+	}
+
+	rows, err = db.Query("SELECT BookID, Title FROM Books")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var title sql.NullString
+		if err := rows.Scan(&id, &title); err != nil {
+			return err
+		}
+		index.PutBook(id, title.String, bookAuthors[id], bookSubjects[id])
+	}
+	return rows.Err()
+}
+
+// loadBookIDLists maps each book to the IDs selected with it by query, which
+// selects pairs of a book ID and another ID.
+func loadBookIDLists(db *sql.DB, query string) (map[int][]int, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := map[int][]int{}
+	for rows.Next() {
+		var bookID, id int
+		if err := rows.Scan(&bookID, &id); err != nil {
+			return nil, err
+		}
+		lists[bookID] = append(lists[bookID], id)
+	}
+	return lists, rows.Err()
+}
+
+// Search godoc
+// @Summary Search the catalogue
+// @Description Find books whose title, the name or biography of one of their contributors, or category name contain every word of the query, most relevant first. Polish diacritics are ignored, so "ksiazka" finds "Książka". Words of three or more letters also match longer words starting with them.
+// @Tags search
+// @Accept  json
+// @Produce  json
+// @Param q query string true "Search query"
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Success 200 {object} models.Page[models.SearchResult]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /search [get]
+func (h *SearchHandler) Search(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "q is required")
+		return
+	}
+	q := newPageQuery(c)
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+
+	hits := h.Index.Search(query)
+	total := len(hits)
+	if q.offset < len(hits) {
+		hits = hits[q.offset:]
+	} else {
+		hits = nil
+	}
+	if len(hits) > q.limit {
+		hits = hits[:q.limit]
+	}
+
+	results := []models.SearchResult{}
+	if len(hits) == 0 {
+		c.JSON(http.StatusOK, newPage(q, results, total))
+		return
+	}
+
+	placeholders := make([]string, len(hits))
+	args := make([]interface{}, len(hits))
+	for i, hit := range hits {
+		placeholders[i] = "?"
+		args[i] = hit.BookID
+	}
+	rows, err := h.DB.Query("SELECT "+bookColumns+" FROM BookAvailability WHERE BookID IN ("+strings.Join(placeholders, ", ")+")", args...)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	var found []models.Book
+	for rows.Next() {
+		var book models.Book
+		if err := scanBook(rows, &book); err != nil {
+			writeError(c, err)
+			return
+		}
+		found = append(found, book)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := loadBookLinks(h.DB, found); err != nil {
+		writeError(c, err)
+		return
+	}
+	books := map[int]models.Book{}
+	for _, book := range found {
+		books[book.BookID] = book
+	}
+
+	for _, hit := range hits {
+		if book, ok := books[hit.BookID]; ok {
+			results = append(results, models.SearchResult{Book: book, Score: hit.Score})
+		}
+	}
+	c.JSON(http.StatusOK, newPage(q, results, total))
+}
+
+// Autocomplete godoc
+// @Summary Suggest books, authors or users
+// @Description Suggest records whose title or name has, for every typed word, a word starting with it, as the query is typed. Polish diacritics are ignored and small typos after the first letter are tolerated when there are not enough exact matches. Users are found by name or email and are only suggested to librarians.
+// @Tags search
+// @Accept  json
+// @Produce  json
+// @Param q query string true "Text typed so far"
+// @Param type query string false "Type of records to suggest" Enums(book, author, user) default(book)
+// @Param limit query int false "Number of suggestions, 1-50" default(10)
+// @Success 200 {array} models.Suggestion
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Security BearerAuth
+// @Router /autocomplete [get]
+func (h *SearchHandler) Autocomplete(c *gin.Context) {
+	recordType := c.DefaultQuery("type", search.TypeBook)
+	if !search.ValidType(recordType) {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "type must be book, author or user")
+		return
+	}
+	if user, _ := CurrentUser(c); recordType == search.TypeUser && !hasRole(user, models.RoleLibrarian) {
+		writeProblem(c, http.StatusForbidden, ProblemCodeForbidden, "Insufficient permissions")
+		return
+	}
+	limit := defaultSuggestions
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSuggestions {
+			writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "limit must be an integer between 1 and "+strconv.Itoa(maxSuggestions))
+			return
+		}
+		limit = n
+	}
+
+	suggestions := []models.Suggestion{}
+	for _, s := range h.Index.Suggest(recordType, c.Query("q"), limit) {
+		suggestions = append(suggestions, models.Suggestion{Type: recordType, ID: s.ID, Label: s.Label, Fuzzy: s.Fuzzy})
+	}
+	c.JSON(http.StatusOK, suggestions)
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type SeriesHandler struct {
+	DB *sql.DB
+}
+
+func NewSeriesHandler(db *sql.DB) *SeriesHandler {
+	return &SeriesHandler{DB: db}
+}
+
+// seriesColumns lists the Series columns in the order expected by scanSeries.
+const seriesColumns = "SeriesID, Name, Description"
+
+func scanSeries(row rowScanner, series *models.Series) error {
+	var description sql.NullString
+	if err := row.Scan(&series.SeriesID, &series.Name, &description); err != nil {
+		return err
+	}
+	series.Description = description.String
+	return nil
+}
+
+// GetSeries godoc
+// @Summary Get a list of series
+// @Description Get a page of series, optionally filtered by a fragment of the name
+// @Tags series
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, name" default(id)
+// @Param name query string false "Fragment of the name"
+// @Success 200 {object} models.Page[models.Series]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /series [get]
+func (h *SeriesHandler) GetSeries(c *gin.Context) {
+	q := newListQuery(c, map[string]string{"id": "SeriesID", "name": "Name"}, "id")
+	q.filterContains("name", "Name")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, seriesColumns, "Series")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	list := []models.Series{}
+	for rows.Next() {
+		var series models.Series
+		if err := scanSeries(rows, &series); err != nil {
+			writeError(c, err)
+			return
+		}
+		list = append(list, series)
+	}
+	c.JSON(http.StatusOK, newPage(q, list, total))
+}
+
+// CreateSeries godoc
+// @Summary Create a new series
+// @Description Add a new series to the database. Works are added to it with their series_id and series_volume.
+// @Tags series
+// @Accept  json
+// @Produce  json
+// @Param series body models.Series true "Create Series"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /series [post]
+func (h *SeriesHandler) CreateSeries(c *gin.Context) {
+	var series models.Series
+	if err := c.ShouldBindJSON(&series); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	_, err := h.DB.Exec("INSERT INTO Series (Name, Description) VALUES (?, ?)", series.Name, series.Description)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Series created"})
+}
+
+// GetSeriesByID godoc
+// @Summary Get details of a specific series
+// @Description Get details of a series given its ID, with its works in volume order; works without a volume number come last
+// @Tags series
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Series ID"
+// @Success 200 {object} models.Series
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /series/{id} [get]
+func (h *SeriesHandler) GetSeriesByID(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var series models.Series
+	err := scanSeries(h.DB.QueryRow("SELECT "+seriesColumns+" FROM Series WHERE SeriesID = ?", id), &series)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Series not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT "+workColumns+" FROM Works WHERE SeriesID = ? ORDER BY SeriesVolume IS NULL, SeriesVolume, WorkID", id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	series.Works = []models.Work{}
+	for rows.Next() {
+		var work models.Work
+		if err := scanWork(rows, &work); err != nil {
+			writeError(c, err)
+			return
+		}
+		series.Works = append(series.Works, work)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
+
+// UpdateSeries godoc
+// @Summary Update a series
+// @Description Update details of a series given its ID
+// @Tags series
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Series ID"
+// @Param series body models.Series true "Update Series"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /series/{id} [put]
+func (h *SeriesHandler) UpdateSeries(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var series models.Series
+	if err := c.ShouldBindJSON(&series); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	_, err := h.DB.Exec("UPDATE Series SET Name = ?, Description = ? WHERE SeriesID = ?", series.Name, series.Description, id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Series updated"})
+}
+
+// DeleteSeries godoc
+// @Summary Delete a series
+// @Description Delete a series given its ID. A series that still has works cannot be deleted.
+// @Tags series
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Series ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /series/{id} [delete]
+func (h *SeriesHandler) DeleteSeries(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var works int
+	if err := h.DB.QueryRow("SELECT COUNT(*) FROM Works WHERE SeriesID = ?", id).Scan(&works); err != nil {
+		writeError(c, err)
+		return
+	}
+	if works > 0 {
+		writeProblem(c, http.StatusConflict, ProblemCodeStillReferenced, fmt.Sprintf("Series has %d works; remove them from it first", works))
+		return
+	}
+
+	_, err := h.DB.Exec("DELETE FROM Series WHERE SeriesID = ?", id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Series deleted"})
+}
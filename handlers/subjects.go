@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	errUnknownCategory = errors.New("Unknown category")
+	errBadSubjects     = errors.New("invalid subjects")
+)
+
+// normalizeSubjects rejects subjects listed twice; their IDs are checked when
+// the body is bound. A book sent with only a category_id is filed under that
+// category alone.
+func normalizeSubjects(book *models.Book) error {
+	if len(book.Subjects) == 0 && book.CategoryID != 0 {
+		book.Subjects = []models.Subject{{CategoryID: book.CategoryID}}
+	}
+	seen := map[int]bool{}
+	for i := range book.Subjects {
+		subject := &book.Subjects[i]
+		subject.Name = ""
+		if seen[subject.CategoryID] {
+			return fmt.Errorf("%w: category %d is listed twice", errBadSubjects, subject.CategoryID)
+		}
+		seen[subject.CategoryID] = true
+	}
+	book.CategoryID = 0
+	if len(book.Subjects) > 0 {
+		book.CategoryID = book.Subjects[0].CategoryID
+	}
+	return nil
+}
+
+// subjectIDs returns the categories of the subjects.
+func subjectIDs(subjects []models.Subject) []int {
+	var ids []int
+	for _, subject := range subjects {
+		ids = append(ids, subject.CategoryID)
+	}
+	return ids
+}
+
+// saveSubjects replaces the subjects of a book, numbering them in order. It
+// returns errUnknownCategory for a category not in the catalogue.
+func saveSubjects(tx *sql.Tx, bookID int, subjects []models.Subject) error {
+	if _, err := tx.Exec("DELETE FROM BookCategories WHERE BookID = ?", bookID); err != nil {
+		return err
+	}
+	for i, subject := range subjects {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM Categories WHERE CategoryID = ?)", subject.CategoryID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w %d", errUnknownCategory, subject.CategoryID)
+		}
+		if _, err := tx.Exec("INSERT INTO BookCategories (BookID, CategoryID, Position) VALUES (?, ?, ?)", bookID, subject.CategoryID, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSubjects fills in the subjects of the books with one query.
+func loadSubjects(db *sql.DB, books []models.Book) error {
+	if len(books) == 0 {
+		return nil
+	}
+	for i := range books {
+		books[i].Subjects = []models.Subject{}
+	}
+	placeholders, args, byID := bookSet(books)
+
+	rows, err := db.Query(`SELECT bc.BookID, bc.CategoryID, c.Name FROM BookCategories bc
+		JOIN Categories c ON c.CategoryID = bc.CategoryID
+		WHERE bc.BookID IN (`+placeholders+`)
+		ORDER BY bc.BookID, bc.Position`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bookID int
+		var subject models.Subject
+		var name sql.NullString
+		if err := rows.Scan(&bookID, &subject.CategoryID, &name); err != nil {
+			return err
+		}
+		subject.Name = name.String
+		for _, i := range byID[bookID] {
+			books[i].Subjects = append(books[i].Subjects, subject)
+		}
+	}
+	return rows.Err()
+}
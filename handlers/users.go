@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"books_rent/models"
+	"books_rent/search"
 	"database/sql"
 	"errors"
 	"github.com/gin-gonic/gin"
@@ -10,39 +11,62 @@ import (
 )
 
 type UserHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Search *search.Index
 }
 
-func NewUserHandler(db *sql.DB) *UserHandler {
-	return &UserHandler{DB: db}
+func NewUserHandler(db *sql.DB, index *search.Index) *UserHandler {
+	return &UserHandler{DB: db, Search: index}
 }
 
 // GetUsers godoc
 // @Summary Get a list of users
-// @Description Get a list of all users
+// @Description Get a page of users, optionally filtered by role, status or a fragment of the name or email
 // @Tags users
 // @Accept  json
 // @Produce  json
-// @Success 200 {array} models.User
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, name, email, expiry_date" default(id)
+// @Param role query string false "Role" Enums(patron, librarian, admin)
+// @Param status query string false "Status" Enums(active, suspended)
+// @Param name query string false "Fragment of the name"
+// @Param email query string false "Fragment of the email"
+// @Success 200 {object} models.Page[models.User]
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /users [get]
 func (h *UserHandler) GetUsers(c *gin.Context) {
-	var users []models.User
-	rows, err := h.DB.Query("SELECT * FROM Users")
+	q := newListQuery(c, map[string]string{"id": "UserID", "name": "Name", "email": "Email", "expiry_date": "ExpiryDate"}, "id")
+	q.filterString("role", "Role")
+	q.filterString("status", "Status")
+	q.filterContains("name", "Name")
+	q.filterContains("email", "Email")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, "UserID, Name, Email, Role, Status, ExpiryDate", "Users")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer rows.Close()
 
+	users := []models.User{}
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.UserID, &user.Name, &user.Email); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		var expiryDate sql.NullString
+		if err := rows.Scan(&user.UserID, &user.Name, &user.Email, &user.Role, &user.Status, &expiryDate); err != nil {
+			writeError(c, err)
 			return
 		}
+		user.ExpiryDate = parseDate(expiryDate)
 		users = append(users, user)
 	}
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, newPage(q, users, total))
 }
 
 // CreateUser godoc
@@ -53,28 +77,59 @@ func (h *UserHandler) GetUsers(c *gin.Context) {
 // @Produce  json
 // @Param user body models.User true "Create User"
 // @Success 201 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /users [post]
 func (h *UserHandler) CreateUser(c *gin.Context) {
 	var user models.User
-	if err := c.BindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&user); err != nil {
+		writeBindError(c, err)
+		return
+	}
+
+	if user.Status == "" {
+		user.Status = models.UserActive
+	}
+	if user.Role == "" {
+		user.Role = models.RolePatron
+	}
+	if !validRole(user.Role) {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "Unknown role "+user.Role)
 		return
 	}
 
-	stmt, err := h.DB.Prepare("INSERT INTO Users (Name, Email) VALUES (?, ?)")
+	var passwordHash sql.NullString
+	if user.Password != "" {
+		hash, err := hashPassword(user.Password)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		passwordHash = sql.NullString{String: hash, Valid: true}
+	}
+
+	stmt, err := h.DB.Prepare("INSERT INTO Users (Name, Email, PasswordHash, Role, Status, ExpiryDate) VALUES (?, ?, ?, ?, ?, ?)")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(user.Name, user.Email)
+	result, err := stmt.Exec(user.Name, user.Email, passwordHash, user.Role, user.Status, formatDate(user.ExpiryDate))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	h.Search.PutUser(int(id), user.Name, user.Email)
 	c.JSON(http.StatusCreated, gin.H{"message": "User created"})
 }
 
@@ -86,49 +141,95 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "User ID"
 // @Success 200 {object} models.User
-// @Failure 404 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /users/{id} [get]
 func (h *UserHandler) GetUserByID(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
+	if !authorizeOwner(c, id, models.RoleLibrarian) {
+		return
+	}
 	var user models.User
-	err := h.DB.QueryRow("SELECT * FROM Users WHERE UserID = ?", id).Scan(&user.UserID, &user.Name, &user.Email)
+	var expiryDate sql.NullString
+	err := h.DB.QueryRow("SELECT UserID, Name, Email, Role, Status, ExpiryDate FROM Users WHERE UserID = ?", id).Scan(&user.UserID, &user.Name, &user.Email, &user.Role, &user.Status, &expiryDate)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "User not found")
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			writeError(c, err)
 		}
 		return
 	}
+	user.ExpiryDate = parseDate(expiryDate)
 	c.JSON(http.StatusOK, user)
 }
 
 // UpdateUser godoc
 // @Summary Update a user
-// @Description Update details of a user given their ID
+// @Description Update details of a user given their ID. The password is only changed when one is given, and the role, status and expiry date only when they are sent. Set clear_expiry to remove the expiry date.
 // @Tags users
 // @Accept  json
 // @Produce  json
 // @Param id path int true "User ID"
 // @Param user body models.User true "Update User"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /users/{id} [put]
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	var user models.User
-	if err := c.BindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if err := c.ShouldBindJSON(&user); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	var exists bool
+	if err := h.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM Users WHERE UserID = ?)", id).Scan(&exists); err != nil {
+		writeError(c, err)
+		return
+	}
+	if !exists {
+		writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "User not found")
 		return
 	}
 
-	_, err := h.DB.Exec("UPDATE Users SET Name = ?, Email = ? WHERE UserID = ?", user.Name, user.Email, id)
+	if user.Role != "" && !validRole(user.Role) {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "Unknown role "+user.Role)
+		return
+	}
+
+	if user.ClearExpiry && user.ExpiryDate != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, "Send either expiry_date or clear_expiry, not both")
+		return
+	}
+
+	// A role, status or expiry date left out keeps its stored value.
+	_, err := h.DB.Exec(`UPDATE Users SET Name = ?, Email = ?, Role = COALESCE(NULLIF(?, ''), Role), Status = COALESCE(NULLIF(?, ''), Status),
+		ExpiryDate = IF(?, NULL, COALESCE(?, ExpiryDate)) WHERE UserID = ?`,
+		user.Name, user.Email, user.Role, user.Status, user.ClearExpiry, formatDate(user.ExpiryDate), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	h.Search.PutUser(id, user.Name, user.Email)
+	if user.Password != "" {
+		hash, err := hashPassword(user.Password)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		if _, err := h.DB.Exec("UPDATE Users SET PasswordHash = ? WHERE UserID = ?", hash, id); err != nil {
+			writeError(c, err)
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "User updated"})
 }
 
@@ -140,14 +241,37 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 // @Produce  json
 // @Param id path int true "User ID"
 // @Success 200 {object} map[string]interface{}
-// @Failure 500 {object} map[string]string
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
 // @Router /users/{id} [delete]
 func (h *UserHandler) DeleteUser(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
 	_, err := h.DB.Exec("DELETE FROM Users WHERE UserID = ?", id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeError(c, err)
 		return
 	}
+	h.Search.DeleteUser(id)
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 }
+
+// GetMe godoc
+// @Summary Get the current user
+// @Description Get the account of the authenticated user
+// @Tags me
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} models.User
+// @Failure 401 {object} models.Problem
+// @Security BearerAuth
+// @Router /me [get]
+func (h *UserHandler) GetMe(c *gin.Context) {
+	user, ok := CurrentUser(c)
+	if !ok {
+		writeProblem(c, http.StatusUnauthorized, ProblemCodeUnauthorized, "Not authenticated")
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
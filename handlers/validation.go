@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProblemCodeValidation is the code of the problem returned when a request
+// body breaks the validation rules in the binding tags of its model.
+const ProblemCodeValidation = "validation_failed"
+
+// Validation errors name fields by their JSON names rather than the names of
+// the Go struct fields. The maxbytes rule limits the length of a string in
+// bytes rather than characters, as bcrypt does for passwords, and the maxyear
+// rule limits a year to the given number of years after the current one.
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		v.RegisterValidation("maxbytes", maxBytes)
+		v.RegisterValidation("maxyear", maxYear)
+	}
+}
+
+// maxBytes checks a string field against the maxbytes rule.
+func maxBytes(fl validator.FieldLevel) bool {
+	limit, err := strconv.Atoi(fl.Param())
+	if err != nil {
+		panic("maxbytes: invalid parameter " + fl.Param())
+	}
+	return len(fl.Field().String()) <= limit
+}
+
+// maxYear checks an integer field against the maxyear rule.
+func maxYear(fl validator.FieldLevel) bool {
+	return fl.Field().Int() <= int64(latestYear(fl.Param()))
+}
+
+// latestYear returns the last year allowed by a maxyear parameter.
+func latestYear(param string) int {
+	ahead, err := strconv.Atoi(param)
+	if err != nil {
+		panic("maxyear: invalid parameter " + param)
+	}
+	return time.Now().Year() + ahead
+}
+
+// writeBindError responds to a failed ShouldBindJSON call: 422 with an error
+// for every field that breaks a rule when the body was valid JSON, or 400
+// when it could not be decoded at all.
+func writeBindError(c *gin.Context, err error) {
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+		return
+	}
+	problem := newProblem(http.StatusUnprocessableEntity, ProblemCodeValidation, "The request body has invalid fields")
+	for _, fe := range invalid {
+		problem.Errors = append(problem.Errors, fieldError(fe))
+	}
+	sendProblem(c, problem)
+}
+
+// fieldError describes the rule a field breaks.
+func fieldError(fe validator.FieldError) models.FieldError {
+	field := fe.Namespace()
+	if _, path, ok := strings.Cut(field, "."); ok {
+		field = path
+	}
+	var message string
+	text := fe.Kind() == reflect.String
+	switch fe.Tag() {
+	case "required":
+		message = field + " is required"
+	case "email":
+		message = field + " must be a valid email address"
+	case "oneof":
+		message = fmt.Sprintf("%s must be one of: %s", field, strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "min":
+		if text {
+			message = fmt.Sprintf("%s must be at least %s characters long", field, fe.Param())
+		} else if fe.Param() == "0" {
+			message = field + " must not be negative"
+		} else {
+			message = fmt.Sprintf("%s must be at least %s", field, fe.Param())
+		}
+	case "max":
+		if text {
+			message = fmt.Sprintf("%s must be at most %s characters long", field, fe.Param())
+		} else {
+			message = fmt.Sprintf("%s must be at most %s", field, fe.Param())
+		}
+	case "len":
+		message = fmt.Sprintf("%s must be exactly %s characters long", field, fe.Param())
+	case "alpha":
+		message = field + " must contain only letters"
+	case "maxyear":
+		message = fmt.Sprintf("%s must be at most %d", field, latestYear(fe.Param()))
+	case "maxbytes":
+		message = fmt.Sprintf("%s must be at most %s bytes long", field, fe.Param())
+	default:
+		message = field + " is invalid"
+	}
+	return models.FieldError{Field: field, Rule: fe.Tag(), Message: message}
+}
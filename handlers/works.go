@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"books_rent/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type WorkHandler struct {
+	DB *sql.DB
+}
+
+func NewWorkHandler(db *sql.DB) *WorkHandler {
+	return &WorkHandler{DB: db}
+}
+
+// workColumns lists the Works columns in the order expected by scanWork.
+const workColumns = "WorkID, Title, OriginalLanguage, SeriesID, SeriesVolume"
+
+var (
+	errUnknownWork   = errors.New("Unknown work")
+	errUnknownSeries = errors.New("Unknown series")
+	errBadSeries     = errors.New("invalid series")
+)
+
+func scanWork(row rowScanner, work *models.Work) error {
+	var language sql.NullString
+	var seriesID, volume sql.NullInt64
+	if err := row.Scan(&work.WorkID, &work.Title, &language, &seriesID, &volume); err != nil {
+		return err
+	}
+	work.OriginalLanguage = language.String
+	work.SeriesID, work.SeriesVolume = nil, nil
+	if seriesID.Valid {
+		id := int(seriesID.Int64)
+		work.SeriesID = &id
+	}
+	if volume.Valid {
+		number := int(volume.Int64)
+		work.SeriesVolume = &number
+	}
+	return nil
+}
+
+// languagePattern matches a MARC language code, such as pol or eng.
+var languagePattern = regexp.MustCompile(`^[a-z]{3}$`)
+
+// normalizeLanguage lower-cases a language code, whose form is checked when
+// the body is bound.
+func normalizeLanguage(code *string) {
+	*code = strings.ToLower(*code)
+}
+
+// checkSeries validates the place of a work in a series: the series must
+// exist, and a volume number must be positive and belong to a series.
+func checkSeries(db *sql.DB, work *models.Work) error {
+	if work.SeriesID == nil {
+		if work.SeriesVolume != nil {
+			return fmt.Errorf("%w: series_volume needs a series_id", errBadSeries)
+		}
+		return nil
+	}
+	if work.SeriesVolume != nil && *work.SeriesVolume <= 0 {
+		return fmt.Errorf("%w: series_volume must be positive", errBadSeries)
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM Series WHERE SeriesID = ?)", *work.SeriesID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w %d", errUnknownSeries, *work.SeriesID)
+	}
+	return nil
+}
+
+// writeWorkError responds to a failed validation of a work.
+func writeWorkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errUnknownSeries):
+		writeProblem(c, http.StatusUnprocessableEntity, ProblemCodeUnknownReference, err.Error())
+	case errors.Is(err, errBadSeries):
+		writeProblem(c, http.StatusBadRequest, ProblemCodeBadRequest, err.Error())
+	default:
+		writeError(c, err)
+	}
+}
+
+// checkEdition normalizes the language of a book and checks that its work
+// exists.
+func checkEdition(db *sql.DB, book *models.Book) error {
+	normalizeLanguage(&book.Language)
+	if book.WorkID == 0 {
+		return nil
+	}
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM Works WHERE WorkID = ?)", book.WorkID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w %d", errUnknownWork, book.WorkID)
+	}
+	return nil
+}
+
+// GetWorks godoc
+// @Summary Get a list of works
+// @Description Get a page of works, optionally filtered by series or a fragment of the title
+// @Tags works
+// @Accept  json
+// @Produce  json
+// @Param limit query int false "Page size, 1-100" default(20)
+// @Param offset query int false "Number of items to skip" default(0)
+// @Param sort query string false "Sort field, prefixed with - for descending: id, title, series_volume" default(id)
+// @Param series_id query int false "Series ID"
+// @Param title query string false "Fragment of the title"
+// @Success 200 {object} models.Page[models.Work]
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /works [get]
+func (h *WorkHandler) GetWorks(c *gin.Context) {
+	q := newListQuery(c, map[string]string{"id": "WorkID", "title": "Title", "series_volume": "SeriesVolume"}, "id")
+	q.filterInt("series_id", "SeriesID")
+	q.filterContains("title", "Title")
+	if q.err != nil {
+		writeProblem(c, http.StatusBadRequest, ProblemCodeInvalidQuery, q.err.Error())
+		return
+	}
+	total, rows, err := q.query(h.DB, workColumns, "Works")
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	works := []models.Work{}
+	for rows.Next() {
+		var work models.Work
+		if err := scanWork(rows, &work); err != nil {
+			writeError(c, err)
+			return
+		}
+		works = append(works, work)
+	}
+	c.JSON(http.StatusOK, newPage(q, works, total))
+}
+
+// CreateWork godoc
+// @Summary Create a new work
+// @Description Add a new work to the database, optionally as a volume of the series given by series_id. Editions are linked to it by setting the work_id of their books.
+// @Tags works
+// @Accept  json
+// @Produce  json
+// @Param work body models.Work true "Create Work"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /works [post]
+func (h *WorkHandler) CreateWork(c *gin.Context) {
+	var work models.Work
+	if err := c.ShouldBindJSON(&work); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	normalizeLanguage(&work.OriginalLanguage)
+	if err := checkSeries(h.DB, &work); err != nil {
+		writeWorkError(c, err)
+		return
+	}
+
+	_, err := h.DB.Exec("INSERT INTO Works (Title, OriginalLanguage, SeriesID, SeriesVolume) VALUES (?, ?, ?, ?)",
+		work.Title, nullString(work.OriginalLanguage), work.SeriesID, work.SeriesVolume)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Work created"})
+}
+
+// GetWorkByID godoc
+// @Summary Get details of a specific work
+// @Description Get details of a work given its ID, with every edition and translation of it, oldest first, and the number of copies of each edition and of those available
+// @Tags works
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Work ID"
+// @Success 200 {object} models.Work
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /works/{id} [get]
+func (h *WorkHandler) GetWorkByID(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var work models.Work
+	err := scanWork(h.DB.QueryRow("SELECT "+workColumns+" FROM Works WHERE WorkID = ?", id), &work)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeProblem(c, http.StatusNotFound, ProblemCodeNotFound, "Work not found")
+		} else {
+			writeError(c, err)
+		}
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT "+bookColumns+" FROM BookAvailability WHERE WorkID = ? ORDER BY PublicationYear IS NULL, PublicationYear, BookID", id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	defer rows.Close()
+
+	work.Editions = []models.Book{}
+	for rows.Next() {
+		var book models.Book
+		if err := scanBook(rows, &book); err != nil {
+			writeError(c, err)
+			return
+		}
+		work.Editions = append(work.Editions, book)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(c, err)
+		return
+	}
+	if err := loadBookLinks(h.DB, work.Editions); err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, work)
+}
+
+// UpdateWork godoc
+// @Summary Update a work
+// @Description Update details of a work given its ID
+// @Tags works
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Work ID"
+// @Param work body models.Work true "Update Work"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} models.Problem
+// @Failure 403 {object} models.Problem
+// @Failure 422 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /works/{id} [put]
+func (h *WorkHandler) UpdateWork(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var work models.Work
+	if err := c.ShouldBindJSON(&work); err != nil {
+		writeBindError(c, err)
+		return
+	}
+	normalizeLanguage(&work.OriginalLanguage)
+	if err := checkSeries(h.DB, &work); err != nil {
+		writeWorkError(c, err)
+		return
+	}
+
+	_, err := h.DB.Exec("UPDATE Works SET Title = ?, OriginalLanguage = ?, SeriesID = ?, SeriesVolume = ? WHERE WorkID = ?",
+		work.Title, nullString(work.OriginalLanguage), work.SeriesID, work.SeriesVolume, id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Work updated"})
+}
+
+// DeleteWork godoc
+// @Summary Delete a work
+// @Description Delete a work given its ID. A work that still has editions or reservations cannot be deleted.
+// @Tags works
+// @Accept  json
+// @Produce  json
+// @Param id path int true "Work ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 403 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Security BearerAuth
+// @Router /works/{id} [delete]
+func (h *WorkHandler) DeleteWork(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var editions, reservations int
+	err := h.DB.QueryRow(`SELECT (SELECT COUNT(*) FROM Books WHERE WorkID = ?),
+		(SELECT COUNT(*) FROM Reservations WHERE WorkID = ?)`, id, id).Scan(&editions, &reservations)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	if editions > 0 {
+		writeProblem(c, http.StatusConflict, ProblemCodeStillReferenced, fmt.Sprintf("Work has %d editions; unlink them first", editions))
+		return
+	}
+	if reservations > 0 {
+		writeProblem(c, http.StatusConflict, ProblemCodeStillReferenced, fmt.Sprintf("Work has %d reservations", reservations))
+		return
+	}
+
+	_, err = h.DB.Exec("DELETE FROM Works WHERE WorkID = ?", id)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Work deleted"})
+}
@@ -0,0 +1,130 @@
+// Package isbn validates International Standard Book Numbers and converts
+// between their 10 and 13 digit forms. ISBNs may be written with hyphens or
+// spaces between the groups of digits; they are stored without them.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrLength   = errors.New("ISBN must have 10 or 13 digits")
+	ErrChecksum = errors.New("ISBN check digit is wrong")
+	ErrNoISBN10 = errors.New("only ISBN-13s starting with 978 have an ISBN-10")
+)
+
+// Normalize removes the hyphens and spaces from an ISBN and upper-cases the X
+// check digit of an ISBN-10.
+func Normalize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ':
+			return -1
+		case 'x':
+			return 'X'
+		}
+		return r
+	}, strings.TrimSpace(s))
+}
+
+// digits reports whether s is made of decimal digits only.
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDigit10 returns the check digit of the first nine digits of an ISBN-10.
+func checkDigit10(s string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(s[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 returns the check digit of the first twelve digits of an
+// ISBN-13.
+func checkDigit13(s string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(s[i]-'0') * weight
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// Valid10 reports whether s, normalized, is an ISBN-10 with a correct check
+// digit.
+func Valid10(s string) bool {
+	s = Normalize(s)
+	return len(s) == 10 && digits(s[:9]) && s[9] == checkDigit10(s)
+}
+
+// Valid13 reports whether s, normalized, is an ISBN-13 with a correct check
+// digit.
+func Valid13(s string) bool {
+	s = Normalize(s)
+	return len(s) == 13 && digits(s) && s[12] == checkDigit13(s)
+}
+
+// Parse validates an ISBN-10 or ISBN-13 and returns it as a normalized
+// ISBN-13, the form ISBNs are stored and compared in.
+func Parse(s string) (string, error) {
+	s = Normalize(s)
+	switch len(s) {
+	case 10:
+		if !digits(s[:9]) || (s[9] != 'X' && !digits(s[9:])) {
+			return "", ErrLength
+		}
+		if !Valid10(s) {
+			return "", ErrChecksum
+		}
+		return To13(s)
+	case 13:
+		if !digits(s) {
+			return "", ErrLength
+		}
+		if !Valid13(s) {
+			return "", ErrChecksum
+		}
+		return s, nil
+	}
+	return "", ErrLength
+}
+
+// To13 converts a valid ISBN-10 to its ISBN-13 by prefixing it with 978 and
+// recomputing the check digit.
+func To13(isbn10 string) (string, error) {
+	isbn10 = Normalize(isbn10)
+	if !Valid10(isbn10) {
+		return "", ErrChecksum
+	}
+	isbn13 := "978" + isbn10[:9]
+	return isbn13 + string(checkDigit13(isbn13)), nil
+}
+
+// To10 converts a valid ISBN-13 to its ISBN-10. Only ISBN-13s in the 978
+// prefix have one.
+func To10(isbn13 string) (string, error) {
+	isbn13 = Normalize(isbn13)
+	if !Valid13(isbn13) {
+		return "", ErrChecksum
+	}
+	if !strings.HasPrefix(isbn13, "978") {
+		return "", ErrNoISBN10
+	}
+	isbn10 := isbn13[3:12]
+	return isbn10 + string(checkDigit10(isbn10)), nil
+}
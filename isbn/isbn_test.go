@@ -0,0 +1,101 @@
+package isbn
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"0-306-40615-2", "0306406152"},
+		{" 978 0 306 40615 7 ", "9780306406157"},
+		{"0-8044-2957-x", "080442957X"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		in               string
+		valid10, valid13 bool
+	}{
+		{"0-306-40615-2", true, false},
+		{"0-8044-2957-X", true, false},
+		{"0-306-40615-3", false, false},
+		{"978-0-306-40615-7", false, true},
+		{"979-10-90636-07-1", false, true},
+		{"978-0-306-40615-8", false, false},
+		{"0-306-40615", false, false},
+		{"97803064061X7", false, false},
+		{"X306406152", false, false},
+	}
+	for _, tt := range tests {
+		if got := Valid10(tt.in); got != tt.valid10 {
+			t.Errorf("Valid10(%q) = %v, want %v", tt.in, got, tt.valid10)
+		}
+		if got := Valid13(tt.in); got != tt.valid13 {
+			t.Errorf("Valid13(%q) = %v, want %v", tt.in, got, tt.valid13)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr error
+	}{
+		{"0-306-40615-2", "9780306406157", nil},
+		{"0-8044-2957-x", "9780804429573", nil},
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{"979-10-90636-07-1", "9791090636071", nil},
+		{"83-7054-152-6", "9788370541521", nil},
+		{"0-306-40615-3", "", ErrChecksum},
+		{"978-0-306-40615-8", "", ErrChecksum},
+		{"0-306-4061", "", ErrLength},
+		{"978-0-306-40615", "", ErrLength},
+		{"03064061A2", "", ErrLength},
+		{"978030640615X", "", ErrLength},
+		{"", "", ErrLength},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != tt.wantErr || got != tt.want {
+			t.Errorf("Parse(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		isbn10, isbn13 string
+	}{
+		{"0306406152", "9780306406157"},
+		{"080442957X", "9780804429573"},
+		{"8370541526", "9788370541521"},
+	}
+	for _, tt := range tests {
+		if got, err := To13(tt.isbn10); err != nil || got != tt.isbn13 {
+			t.Errorf("To13(%q) = %q, %v; want %q", tt.isbn10, got, err, tt.isbn13)
+		}
+		if got, err := To10(tt.isbn13); err != nil || got != tt.isbn10 {
+			t.Errorf("To10(%q) = %q, %v; want %q", tt.isbn13, got, err, tt.isbn10)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	if _, err := To13("0306406153"); err != ErrChecksum {
+		t.Errorf("To13 with a wrong check digit: got %v, want %v", err, ErrChecksum)
+	}
+	if _, err := To10("9780306406158"); err != ErrChecksum {
+		t.Errorf("To10 with a wrong check digit: got %v, want %v", err, ErrChecksum)
+	}
+	if _, err := To10("9791090636071"); err != ErrNoISBN10 {
+		t.Errorf("To10 of a 979 ISBN: got %v, want %v", err, ErrNoISBN10)
+	}
+}
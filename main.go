@@ -1,11 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	_ "books_rent/docs"
 	"books_rent/handlers"
+	"books_rent/models"
+	"books_rent/search"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -17,6 +28,12 @@ import (
 var db *sql.DB
 var err error
 
+// @title Wypożyczalnia Książek API
+// @description REST API of the library: catalogue, loans, reservations, fines and reviews.
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description Access token from /auth/login, sent as "Bearer <token>".
 func main() {
 	db, err = sql.Open("mysql", "root:new_password@tcp(db)/library")
 	if err != nil {
@@ -29,64 +46,243 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowAllOrigins: true,
 		AllowMethods:    []string{"GET", "POST", "PUT", "DELETE"},
-		AllowHeaders:    []string{"Origin", "Content-Type"},
+		AllowHeaders:    []string{"Origin", "Content-Type", "Authorization"},
 	}))
 
-	bookHandler := handlers.NewBookHandler(db)
-	authorHandler := handlers.NewAuthorHandler(db)
-	categoriesHandler := handlers.NewCategoryHandler(db)
-	loansHandler := handlers.NewLoanHandler(db)
-	reservationHandler := handlers.NewReservationHandler(db)
+	policy := loadPolicy()
+
+	searchIndex := search.NewIndex()
+	if err := handlers.LoadSearchIndex(db, searchIndex); err != nil {
+		log.Fatal(err)
+	}
+
+	bookHandler := handlers.NewBookHandler(db, searchIndex)
+	copyHandler := handlers.NewCopyHandler(db, policy)
+	authorHandler := handlers.NewAuthorHandler(db, searchIndex)
+	categoriesHandler := handlers.NewCategoryHandler(db, searchIndex)
+	searchHandler := handlers.NewSearchHandler(db, searchIndex)
+	importHandler := handlers.NewImportHandler(db, searchIndex)
+	loansHandler := handlers.NewLoanHandler(db, policy)
+	reservationHandler := handlers.NewReservationHandler(db, policy)
 	reviewsHandler := handlers.NewReviewHandler(db)
-	userHandler := handlers.NewUserHandler(db)
-
-	r.GET("/books", bookHandler.GetBooks)
-	r.GET("/books/available", bookHandler.GetAvailableBooks)
-	r.GET("/books/top-rated", bookHandler.GetTopRatedBooks)
-	r.POST("/books", bookHandler.CreateBook)
-	r.GET("/books/:id", bookHandler.GetBookByID)
-	r.PUT("/books/:id", bookHandler.UpdateBook)
-	r.DELETE("/books/:id", bookHandler.DeleteBook)
-
-	r.GET("/authors", authorHandler.GetAuthors)
-	r.POST("/authors", authorHandler.CreateAuthor)
-	r.GET("/authors/:id", authorHandler.GetAuthorByID)
-	r.PUT("/authors/:id", authorHandler.UpdateAuthor)
-	r.DELETE("/authors/:id", authorHandler.DeleteAuthor)
-
-	r.GET("/categories", categoriesHandler.GetCategories)
-	r.POST("/categories", categoriesHandler.CreateCategory)
-	r.GET("/categories/:id", categoriesHandler.GetCategoryByID)
-	r.PUT("/categories/:id", categoriesHandler.UpdateCategory)
-	r.DELETE("/categories/:id", categoriesHandler.DeleteCategory)
-
-	r.GET("/loans", loansHandler.GetLoans)
-	r.POST("/loans", loansHandler.CreateLoan)
-	r.GET("/loans/:id", loansHandler.GetLoanByID)
-	r.PUT("/loans/:id", loansHandler.UpdateLoan)
-	r.DELETE("/loans/:id", loansHandler.DeleteLoan)
-	r.GET("/loans/history", loansHandler.GetUserLoanHistory)
-
-	r.GET("/reservations", reservationHandler.GetReservations)
-	r.POST("/reservations", reservationHandler.CreateReservation)
-	r.GET("/reservations/:id", reservationHandler.GetReservationByID)
-	r.PUT("/reservations/:id", reservationHandler.UpdateReservation)
-	r.DELETE("/reservations/:id", reservationHandler.DeleteReservation)
-
-	r.GET("/reviews", reviewsHandler.GetReviews)
-	r.POST("/reviews", reviewsHandler.CreateReview)
-	r.GET("/reviews/:id", reviewsHandler.GetReviewByID)
-	r.PUT("/reviews/:id", reviewsHandler.UpdateReview)
-	r.DELETE("/reviews/:id", reviewsHandler.DeleteReview)
-
-	r.GET("/users", userHandler.GetUsers)
-	r.POST("/users", userHandler.CreateUser)
-	r.GET("/users/:id", userHandler.GetUserByID)
-	r.PUT("/users/:id", userHandler.UpdateUser)
-	r.DELETE("/users/:id", userHandler.DeleteUser)
+	userHandler := handlers.NewUserHandler(db, searchIndex)
+	publisherHandler := handlers.NewPublisherHandler(db)
+	workHandler := handlers.NewWorkHandler(db)
+	seriesHandler := handlers.NewSeriesHandler(db)
+	fineHandler := handlers.NewFineHandler(db)
+	authHandler := handlers.NewAuthHandler(db, loadJWTSecret(), envDuration("ACCESS_TOKEN_TTL", 15*time.Minute), envDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour))
+
+	r.POST("/auth/login", authHandler.Login)
+	r.POST("/auth/refresh", authHandler.Refresh)
+
+	api := r.Group("/", authHandler.RequireAuth())
+	librarian := api.Group("/", handlers.RequireRole(models.RoleLibrarian))
+	admin := api.Group("/", handlers.RequireRole(models.RoleAdmin))
+
+	api.GET("/books", bookHandler.GetBooks)
+	api.GET("/books/available", bookHandler.GetAvailableBooks)
+	api.GET("/books/top-rated", bookHandler.GetTopRatedBooks)
+	api.GET("/books/isbn/:isbn", bookHandler.GetBookByISBN)
+	librarian.POST("/books", bookHandler.CreateBook)
+	api.GET("/books/:id", bookHandler.GetBookByID)
+	librarian.PUT("/books/:id", bookHandler.UpdateBook)
+	admin.DELETE("/books/:id", bookHandler.DeleteBook)
+	librarian.GET("/books/:id/reservations", reservationHandler.GetBookReservationQueue)
+
+	librarian.GET("/copies", copyHandler.GetCopies)
+	librarian.POST("/copies", copyHandler.CreateCopy)
+	api.GET("/copies/barcode/:barcode", copyHandler.GetCopyByBarcode)
+	api.GET("/copies/:id", copyHandler.GetCopyByID)
+	librarian.PUT("/copies/:id", copyHandler.UpdateCopy)
+	admin.DELETE("/copies/:id", copyHandler.DeleteCopy)
+
+	api.GET("/search", searchHandler.Search)
+	api.GET("/autocomplete", searchHandler.Autocomplete)
+
+	librarian.POST("/import/marc", importHandler.ImportMARC)
+	librarian.POST("/import/csv/:resource", importHandler.ImportCSV)
+	librarian.GET("/export/csv/:resource", importHandler.ExportCSV)
+
+	api.GET("/authors", authorHandler.GetAuthors)
+	admin.POST("/authors", authorHandler.CreateAuthor)
+	api.GET("/authors/:id", authorHandler.GetAuthorByID)
+	admin.PUT("/authors/:id", authorHandler.UpdateAuthor)
+	admin.DELETE("/authors/:id", authorHandler.DeleteAuthor)
+	api.GET("/authors/:id/books", authorHandler.GetAuthorBooks)
+
+	api.GET("/publishers", publisherHandler.GetPublishers)
+	librarian.POST("/publishers", publisherHandler.CreatePublisher)
+	api.GET("/publishers/:id", publisherHandler.GetPublisherByID)
+	librarian.PUT("/publishers/:id", publisherHandler.UpdatePublisher)
+	admin.DELETE("/publishers/:id", publisherHandler.DeletePublisher)
+	api.GET("/publishers/:id/books", publisherHandler.GetPublisherBooks)
+
+	api.GET("/works", workHandler.GetWorks)
+	librarian.POST("/works", workHandler.CreateWork)
+	api.GET("/works/:id", workHandler.GetWorkByID)
+	librarian.PUT("/works/:id", workHandler.UpdateWork)
+	admin.DELETE("/works/:id", workHandler.DeleteWork)
+
+	api.GET("/series", seriesHandler.GetSeries)
+	librarian.POST("/series", seriesHandler.CreateSeries)
+	api.GET("/series/:id", seriesHandler.GetSeriesByID)
+	librarian.PUT("/series/:id", seriesHandler.UpdateSeries)
+	admin.DELETE("/series/:id", seriesHandler.DeleteSeries)
+
+	api.GET("/categories", categoriesHandler.GetCategories)
+	api.GET("/categories/tree", categoriesHandler.GetCategoryTree)
+	admin.POST("/categories", categoriesHandler.CreateCategory)
+	api.GET("/categories/:id", categoriesHandler.GetCategoryByID)
+	admin.PUT("/categories/:id", categoriesHandler.UpdateCategory)
+	admin.DELETE("/categories/:id", categoriesHandler.DeleteCategory)
+	api.GET("/categories/:id/books", categoriesHandler.GetCategoryBooks)
+
+	librarian.GET("/loans", loansHandler.GetLoans)
+	librarian.POST("/loans", loansHandler.CreateLoan)
+	api.GET("/loans/:id", loansHandler.GetLoanByID)
+	librarian.PUT("/loans/:id", loansHandler.UpdateLoan)
+	admin.DELETE("/loans/:id", loansHandler.DeleteLoan)
+	librarian.POST("/loans/:id/return", loansHandler.ReturnLoan)
+	librarian.POST("/loans/:id/renew", loansHandler.RenewLoan)
+	librarian.GET("/loans/history", loansHandler.GetUserLoanHistory)
+	librarian.GET("/loans/overdue", loansHandler.GetOverdueLoans)
+
+	librarian.GET("/reservations", reservationHandler.GetReservations)
+	api.POST("/reservations", reservationHandler.CreateReservation)
+	api.GET("/reservations/:id", reservationHandler.GetReservationByID)
+	librarian.PUT("/reservations/:id", reservationHandler.UpdateReservation)
+	api.DELETE("/reservations/:id", reservationHandler.DeleteReservation)
+
+	api.GET("/reviews", reviewsHandler.GetReviews)
+	api.POST("/reviews", reviewsHandler.CreateReview)
+	api.GET("/reviews/:id", reviewsHandler.GetReviewByID)
+	api.PUT("/reviews/:id", reviewsHandler.UpdateReview)
+	api.DELETE("/reviews/:id", reviewsHandler.DeleteReview)
+
+	librarian.GET("/users", userHandler.GetUsers)
+	admin.POST("/users", userHandler.CreateUser)
+	api.GET("/users/:id", userHandler.GetUserByID)
+	admin.PUT("/users/:id", userHandler.UpdateUser)
+	admin.DELETE("/users/:id", userHandler.DeleteUser)
+	api.GET("/users/:id/fines", fineHandler.GetUserFines)
+	api.GET("/users/:id/eligibility", loansHandler.GetUserEligibility)
+
+	api.GET("/me", userHandler.GetMe)
+	api.GET("/me/loans", loansHandler.GetMyLoans)
+	api.GET("/me/reservations", reservationHandler.GetMyReservations)
+	api.GET("/me/reviews", reviewsHandler.GetMyReviews)
+	api.GET("/me/fines", fineHandler.GetMyFines)
+
+	librarian.GET("/fines/ledger", fineHandler.GetFineLedger)
+	api.GET("/fines/:id", fineHandler.GetFineByID)
+	librarian.POST("/fines/:id/payments", fineHandler.PayFine)
+	librarian.POST("/fines/:id/waive", fineHandler.WaiveFine)
 
 	url := ginSwagger.URL("http://localhost:8080/swagger/doc.json")
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, url))
+
+	// Background jobs and the server stop on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go reservationHandler.RunHoldExpiry(ctx, time.Hour)
+
 	// Start the server
-	r.Run(":8080")
+	server := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutting down: %v", err)
+	}
+}
+
+// loadPolicy returns the default circulation rules with any overrides taken
+// from the environment.
+func loadPolicy() handlers.Policy {
+	policy := handlers.DefaultPolicy()
+	envInt("LOAN_PERIOD_DAYS", &policy.LoanPeriodDays)
+	envInt("MAX_RENEWALS", &policy.MaxRenewals)
+	envInt("RENEWAL_GRACE_DAYS", &policy.RenewalGraceDays)
+	envFloat("FINE_DAILY_RATE", &policy.FineDailyRate)
+	envFloat("FINE_CAP", &policy.FineCap)
+	envInt("MAX_ACTIVE_LOANS", &policy.MaxActiveLoans)
+	envFloat("MAX_OUTSTANDING_FINES", &policy.MaxOutstandingFines)
+	envInt("HOLD_PICKUP_DAYS", &policy.HoldPickupDays)
+	return policy
+}
+
+// envInt overrides target with the integer value of the named environment
+// variable, if it is set.
+func envInt(name string, target *int) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	*target = parsed
+}
+
+// envFloat overrides target with the decimal value of the named environment
+// variable, if it is set.
+func envFloat(name string, target *float64) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	*target = parsed
+}
+
+// envDuration returns the duration in the named environment variable, or
+// fallback when it is not set.
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", name, err)
+	}
+	return parsed
+}
+
+// minJWTSecretLength is the shortest signing key accepted, in bytes: the size
+// of an HS256 key.
+const minJWTSecretLength = 32
+
+// defaultJWTSecrets are placeholder keys from examples and earlier versions of
+// docker-compose.yml, which must never sign real tokens.
+var defaultJWTSecrets = []string{"change-me", "changeme", "secret", "jwt-secret", "your-secret-key"}
+
+// loadJWTSecret returns the key used to sign access and refresh tokens. The
+// server refuses to start with a missing, short or well-known key.
+func loadJWTSecret() []byte {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		log.Fatal("JWT_SECRET must be set")
+	}
+	for _, weak := range defaultJWTSecrets {
+		if strings.EqualFold(secret, weak) {
+			log.Fatal("JWT_SECRET is a well-known placeholder; set it to a random string")
+		}
+	}
+	if len(secret) < minJWTSecretLength {
+		log.Fatalf("JWT_SECRET must be at least %d bytes long", minJWTSecretLength)
+	}
+	return []byte(secret)
 }
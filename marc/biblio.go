@@ -0,0 +1,166 @@
+package marc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// clean trims the whitespace and the ISBD punctuation that cataloguers put
+// between subfields, such as the " /" ending a title or the " :" ending a
+// place of publication.
+func clean(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimRight(s, " /:;,=")
+	// A final full stop ends the field, but is kept after an initial such as
+	// "Tolkien, J. R. R.".
+	if strings.HasSuffix(s, ".") && !(len(s) >= 3 && s[len(s)-3] == ' ') {
+		s = strings.TrimSuffix(s, ".")
+	}
+	return strings.TrimSpace(s)
+}
+
+// Title returns the title proper from field 245, followed by the remainder of
+// the title when there is one.
+func (r *Record) Title() string {
+	for _, f := range r.DataFields("245") {
+		title := clean(f.Subfield('a'))
+		if rest := clean(f.Subfield('b')); rest != "" {
+			title += ": " + rest
+		}
+		return title
+	}
+	return ""
+}
+
+// personalName turns a name entered surname first, as "Lem, Stanisław", into
+// direct order. First indicator 1 marks a surname entry.
+func personalName(f Field) string {
+	name := clean(f.Subfield('a'))
+	if f.Ind1 == '1' {
+		if surname, forenames, ok := strings.Cut(name, ", "); ok {
+			name = forenames + " " + surname
+		}
+	}
+	return name
+}
+
+// Contributor is a person named in field 100 or 700 with their relator: the
+// relator code from subfield $4, such as "trl", or else the relator term from
+// subfield $e, such as "tłumaczenie". Relator is empty when neither is given.
+type Contributor struct {
+	Name    string
+	Relator string
+}
+
+// Contributors returns the main entry from field 100 followed by the added
+// entries from field 700, in direct order and without duplicates.
+func (r *Record) Contributors() []Contributor {
+	var contributors []Contributor
+	seen := map[Contributor]bool{}
+	for _, f := range append(r.DataFields("100"), r.DataFields("700")...) {
+		contributor := Contributor{Name: personalName(f), Relator: strings.TrimSpace(f.Subfield('4'))}
+		if contributor.Relator == "" {
+			contributor.Relator = strings.ToLower(clean(f.Subfield('e')))
+		}
+		if contributor.Name != "" && !seen[contributor] {
+			seen[contributor] = true
+			contributors = append(contributors, contributor)
+		}
+	}
+	return contributors
+}
+
+// Publisher returns the publisher's name and place of publication. Field 264
+// with second indicator 1 marks the publication in RDA records; older records
+// use field 260.
+func (r *Record) Publisher() (name, place string) {
+	fields := r.DataFields("264")
+	for _, f := range fields {
+		if f.Ind2 == '1' {
+			return clean(f.Subfield('b')), clean(f.Subfield('a'))
+		}
+	}
+	fields = append(r.DataFields("260"), fields...)
+	for _, f := range fields {
+		if name := clean(f.Subfield('b')); name != "" {
+			return name, clean(f.Subfield('a'))
+		}
+	}
+	return "", ""
+}
+
+// ISBNs returns the ISBNs in field 020 as written, without qualifiers such as
+// "(pbk.)".
+func (r *Record) ISBNs() []string {
+	var isbns []string
+	for _, f := range r.DataFields("020") {
+		if value, _, _ := strings.Cut(strings.TrimSpace(f.Subfield('a')), " "); value != "" {
+			isbns = append(isbns, value)
+		}
+	}
+	return isbns
+}
+
+// Subjects returns the topical terms from field 650, without duplicates.
+func (r *Record) Subjects() []string {
+	var subjects []string
+	seen := map[string]bool{}
+	for _, f := range r.DataFields("650") {
+		if subject := clean(f.Subfield('a')); subject != "" && !seen[subject] {
+			seen[subject] = true
+			subjects = append(subjects, subject)
+		}
+	}
+	return subjects
+}
+
+// UDC returns the UDC number from field 080, or "" when there is none.
+func (r *Record) UDC() string {
+	for _, f := range r.DataFields("080") {
+		if number := strings.TrimSpace(f.Subfield('a')); number != "" {
+			return number
+		}
+	}
+	return ""
+}
+
+// Dewey returns the Dewey number from field 082 without the prime marks, the
+// slashes and apostrophes that show where the number may be shortened, or ""
+// when there is none.
+func (r *Record) Dewey() string {
+	for _, f := range r.DataFields("082") {
+		number := strings.NewReplacer("/", "", "'", "").Replace(strings.TrimSpace(f.Subfield('a')))
+		if number != "" {
+			return number
+		}
+	}
+	return ""
+}
+
+// Year returns the date of publication from positions 07-10 of field 008, or
+// 0 when it is not a complete year.
+func (r *Record) Year() int {
+	field := r.ControlField("008")
+	if len(field) < 11 {
+		return 0
+	}
+	year, err := strconv.Atoi(field[7:11])
+	if err != nil || year <= 0 {
+		return 0
+	}
+	return year
+}
+
+// Language returns the language code from positions 35-37 of field 008, such
+// as "pol", or "" when it is blank or not coded.
+func (r *Record) Language() string {
+	field := r.ControlField("008")
+	if len(field) < 38 {
+		return ""
+	}
+	code := strings.TrimSpace(field[35:38])
+	if len(code) != 3 || code == "|||" {
+		return ""
+	}
+	return code
+}
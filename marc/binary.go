@@ -0,0 +1,108 @@
+package marc
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Delimiters of the ISO 2709 exchange format.
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+const (
+	leaderLength         = 24
+	directoryEntryLength = 12
+)
+
+// parseBinary splits a binary MARC21 file into records. Each record is found
+// by the length in its leader, or by the next record terminator when that
+// length is damaged, so that one bad record is reported and skipped.
+func parseBinary(data []byte) []Result {
+	var results []Result
+	for {
+		data = bytes.TrimLeft(data, " \t\r\n")
+		if len(data) == 0 {
+			return results
+		}
+
+		var raw []byte
+		length, err := strconv.Atoi(string(data[:min(5, len(data))]))
+		if err == nil && length >= leaderLength && length <= len(data) && data[length-1] == recordTerminator {
+			raw, data = data[:length], data[length:]
+		} else if end := bytes.IndexByte(data, recordTerminator); end >= 0 {
+			data = data[end+1:]
+			results = append(results, Result{Err: fmt.Errorf("record length in the leader does not match the record")})
+			continue
+		} else {
+			raw, data = data, nil
+		}
+
+		record, err := decodeBinary(raw)
+		if err != nil {
+			results = append(results, Result{Err: err})
+		} else {
+			results = append(results, Result{Record: record})
+		}
+	}
+}
+
+// decodeBinary decodes a single ISO 2709 record.
+func decodeBinary(raw []byte) (*Record, error) {
+	if len(raw) < leaderLength+1 || raw[len(raw)-1] != recordTerminator {
+		return nil, fmt.Errorf("record is truncated")
+	}
+	leader := string(raw[:leaderLength])
+	// Position 9 of the leader is 'a' for UTF-8. Other records are in MARC-8,
+	// which is only accepted when it is plain ASCII.
+	if leader[9] != 'a' && !utf8.Valid(raw) {
+		return nil, fmt.Errorf("MARC-8 encoded records are not supported")
+	}
+	base, err := strconv.Atoi(leader[12:17])
+	if err != nil || base <= leaderLength || base > len(raw) || raw[base-1] != fieldTerminator {
+		return nil, fmt.Errorf("invalid base address of data in the leader")
+	}
+
+	directory := raw[leaderLength : base-1]
+	if len(directory)%directoryEntryLength != 0 {
+		return nil, fmt.Errorf("invalid directory length")
+	}
+	record := &Record{Leader: leader}
+	for i := 0; i < len(directory); i += directoryEntryLength {
+		entry := directory[i : i+directoryEntryLength]
+		tag := string(entry[:3])
+		length, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil || base+start+length > len(raw)-1 || length < 1 {
+			return nil, fmt.Errorf("invalid directory entry for field %s", tag)
+		}
+		data := bytes.TrimSuffix(raw[base+start:base+start+length], []byte{fieldTerminator})
+		record.Fields = append(record.Fields, decodeField(tag, data))
+	}
+	return record, nil
+}
+
+// decodeField decodes the data of a field. Tags 001 to 009 are control fields;
+// the others start with two indicators followed by the subfields.
+func decodeField(tag string, data []byte) Field {
+	field := Field{Tag: tag}
+	if tag < "010" {
+		field.Value = string(data)
+		return field
+	}
+	parts := bytes.Split(data, []byte{subfieldDelimiter})
+	if indicators := parts[0]; len(indicators) >= 2 {
+		field.Ind1, field.Ind2 = indicators[0], indicators[1]
+	}
+	for _, part := range parts[1:] {
+		if len(part) == 0 {
+			continue
+		}
+		field.Subfields = append(field.Subfields, Subfield{Code: part[0], Value: string(part[1:])})
+	}
+	return field
+}
@@ -0,0 +1,92 @@
+// Package marc reads bibliographic records from MARC21 files, either in the
+// binary ISO 2709 exchange format or as MARCXML, and extracts the fields the
+// catalogue needs from them.
+package marc
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Record is a MARC21 record: its leader and its fields in file order.
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+// Field is a control field, which only has a Value, or a data field with two
+// indicators and its subfields.
+type Field struct {
+	Tag       string
+	Value     string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// Result is one record read from a file, or the error that prevented it from
+// being read. A damaged record does not stop the records after it from being
+// read.
+type Result struct {
+	Record *Record
+	Err    error
+}
+
+var ErrNoRecords = errors.New("file contains no MARC records")
+
+// Parse reads every record of a MARC21 or MARCXML file. The format is told
+// from the content: MARCXML starts with an XML declaration or element. An
+// error is returned only when the file as a whole cannot be read.
+func Parse(data []byte) ([]Result, error) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff")
+	var results []Result
+	var err error
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		results, err = parseXML(trimmed)
+	} else {
+		results = parseBinary(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, ErrNoRecords
+	}
+	return results, nil
+}
+
+// ControlField returns the value of the first control field with the tag.
+func (r *Record) ControlField(tag string) string {
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// DataFields returns the data fields with the tag.
+func (r *Record) DataFields(tag string) []Field {
+	var fields []Field
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// Subfield returns the value of the first subfield with the code.
+func (f Field) Subfield(code byte) string {
+	for _, s := range f.Subfields {
+		if s.Code == code {
+			return s.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,297 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// encode writes fields as an ISO 2709 record with the given character coding
+// in position 9 of the leader.
+func encode(coding byte, fields ...Field) []byte {
+	var directory, data bytes.Buffer
+	for _, f := range fields {
+		start := data.Len()
+		if f.Tag < "010" {
+			data.WriteString(f.Value)
+		} else {
+			data.WriteByte(f.Ind1)
+			data.WriteByte(f.Ind2)
+			for _, s := range f.Subfields {
+				data.WriteByte(subfieldDelimiter)
+				data.WriteByte(s.Code)
+				data.WriteString(s.Value)
+			}
+		}
+		data.WriteByte(fieldTerminator)
+		fmt.Fprintf(&directory, "%s%04d%05d", f.Tag, data.Len()-start, start)
+	}
+	base := leaderLength + directory.Len() + 1
+	length := base + data.Len() + 1
+	record := fmt.Sprintf("%05dnam %c22%05d   4500", length, coding, base)
+	record += directory.String() + string(rune(fieldTerminator)) + data.String() + string(rune(recordTerminator))
+	return []byte(record)
+}
+
+// field008 returns a field 008 with the year of publication and language.
+func field008(year, language string) Field {
+	value := "240101s" + year + "    pl " + strings.Repeat(" ", 17) + language + " d"
+	return Field{Tag: "008", Value: value}
+}
+
+func data(tag string, ind1, ind2 byte, subfields ...string) Field {
+	f := Field{Tag: tag, Ind1: ind1, Ind2: ind2}
+	for _, s := range subfields {
+		f.Subfields = append(f.Subfields, Subfield{Code: s[0], Value: s[1:]})
+	}
+	return f
+}
+
+// solaris is a record with the fields the catalogue reads.
+var solaris = []Field{
+	{Tag: "001", Value: "b0001"},
+	field008("1961", "pol"),
+	data("020", ' ', ' ', "a978-83-08-04928-8 (opr.)"),
+	data("080", ' ', ' ', "a821.162.1-3"),
+	data("100", '1', ' ', "aLem, Stanisław", "4aut"),
+	data("245", '1', '0', "aSolaris /", "cStanisław Lem."),
+	data("264", ' ', '1', "aKraków :", "bWydawnictwo Literackie,", "c2008."),
+	data("650", ' ', '7', "aPowieść polska", "2DBN"),
+	data("650", ' ', '7', "aFantastyka naukowa."),
+	data("650", ' ', '7', "aPowieść polska"),
+	data("700", '1', ' ', "aKowalski, Jan", "etłumaczenie"),
+}
+
+func TestParseBinary(t *testing.T) {
+	results, err := Parse(encode('a', solaris...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("Parse = %+v, want one record", results)
+	}
+	checkSolaris(t, results[0].Record)
+}
+
+func TestParseXML(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"collection with namespace", `<?xml version="1.0" encoding="UTF-8"?>
+<collection xmlns="http://www.loc.gov/MARC21/slim">` + solarisXML + `</collection>`},
+		{"single record without namespace", solarisXML},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Parse([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || results[0].Err != nil {
+				t.Fatalf("Parse = %+v, want one record", results)
+			}
+			checkSolaris(t, results[0].Record)
+		})
+	}
+}
+
+const solarisXML = `<record>
+  <leader>00000nam a2200000   4500</leader>
+  <controlfield tag="001">b0001</controlfield>
+  <controlfield tag="008">240101s1961    pl                  pol d</controlfield>
+  <datafield tag="020" ind1=" " ind2=" "><subfield code="a">978-83-08-04928-8 (opr.)</subfield></datafield>
+  <datafield tag="080" ind1="" ind2=""><subfield code="a">821.162.1-3</subfield></datafield>
+  <datafield tag="100" ind1="1" ind2=" "><subfield code="a">Lem, Stanisław</subfield><subfield code="4">aut</subfield></datafield>
+  <datafield tag="245" ind1="1" ind2="0"><subfield code="a">Solaris /</subfield><subfield code="c">Stanisław Lem.</subfield></datafield>
+  <datafield tag="264" ind1=" " ind2="1"><subfield code="a">Kraków :</subfield><subfield code="b">Wydawnictwo Literackie,</subfield></datafield>
+  <datafield tag="650" ind1=" " ind2="7"><subfield code="a">Powieść polska</subfield></datafield>
+  <datafield tag="650" ind1=" " ind2="7"><subfield code="a">Fantastyka naukowa.</subfield></datafield>
+  <datafield tag="700" ind1="1" ind2=" "><subfield code="a">Kowalski, Jan</subfield><subfield code="e">Tłumaczenie</subfield></datafield>
+</record>`
+
+func checkSolaris(t *testing.T, r *Record) {
+	t.Helper()
+	if got := r.ControlField("001"); got != "b0001" {
+		t.Errorf("ControlField(001) = %q", got)
+	}
+	if got := r.Title(); got != "Solaris" {
+		t.Errorf("Title() = %q", got)
+	}
+	wantContributors := []Contributor{{"Stanisław Lem", "aut"}, {"Jan Kowalski", "tłumaczenie"}}
+	if got := r.Contributors(); !reflect.DeepEqual(got, wantContributors) {
+		t.Errorf("Contributors() = %+v, want %+v", got, wantContributors)
+	}
+	if name, place := r.Publisher(); name != "Wydawnictwo Literackie" || place != "Kraków" {
+		t.Errorf("Publisher() = %q, %q", name, place)
+	}
+	if got := r.ISBNs(); !reflect.DeepEqual(got, []string{"978-83-08-04928-8"}) {
+		t.Errorf("ISBNs() = %q", got)
+	}
+	if got := r.Subjects(); !reflect.DeepEqual(got, []string{"Powieść polska", "Fantastyka naukowa"}) {
+		t.Errorf("Subjects() = %q", got)
+	}
+	if got := r.UDC(); got != "821.162.1-3" {
+		t.Errorf("UDC() = %q", got)
+	}
+	if got := r.Year(); got != 1961 {
+		t.Errorf("Year() = %d", got)
+	}
+	if got := r.Language(); got != "pol" {
+		t.Errorf("Language() = %q", got)
+	}
+}
+
+func TestParseBinaryDamaged(t *testing.T) {
+	good := encode('a', data("245", '0', '0', "aFirst"))
+	last := encode('a', data("245", '0', '0', "aLast"))
+
+	wrongLength := encode('a', data("245", '0', '0', "aWrong length"))
+	copy(wrongLength, "99999")
+
+	badBase := encode('a', data("245", '0', '0', "aBad base"))
+	copy(badBase[12:17], "00030")
+
+	badEntry := encode('a', data("245", '0', '0', "aBad entry"))
+	copy(badEntry[leaderLength+3:leaderLength+7], "0999")
+
+	badDirectory := encode('a', data("245", '0', '0', "aBad directory"))
+	base := leaderLength + directoryEntryLength + 1
+	badDirectory = append(badDirectory[:base-1:base-1], append([]byte("12"), badDirectory[base-1:]...)...)
+	copy(badDirectory, fmt.Sprintf("%05d", len(badDirectory)))
+	copy(badDirectory[12:17], fmt.Sprintf("%05d", base+2))
+
+	marc8 := encode(' ', data("245", '0', '0', "aZa\xb3o\xbf"))
+
+	truncated := encode('a', data("245", '0', '0', "aTruncated"))
+	truncated = truncated[:len(truncated)-1]
+
+	tests := []struct {
+		name   string
+		record []byte
+		want   string
+	}{
+		{"length not matching the record", wrongLength, "record length in the leader does not match the record"},
+		{"base address", badBase, "invalid base address of data in the leader"},
+		{"directory entry past the data", badEntry, "invalid directory entry for field 245"},
+		{"directory length", badDirectory, "invalid directory length"},
+		{"MARC-8", marc8, "MARC-8 encoded records are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := bytes.Join([][]byte{good, tt.record, last}, nil)
+			results, err := Parse(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 3 {
+				t.Fatalf("got %d results, want 3", len(results))
+			}
+			if results[0].Err != nil || results[0].Record.Title() != "First" {
+				t.Errorf("first record = %+v", results[0])
+			}
+			if results[1].Err == nil || results[1].Err.Error() != tt.want {
+				t.Errorf("damaged record error = %v, want %q", results[1].Err, tt.want)
+			}
+			if results[2].Err != nil || results[2].Record.Title() != "Last" {
+				t.Errorf("last record = %+v", results[2])
+			}
+		})
+	}
+
+	t.Run("truncated last record", func(t *testing.T) {
+		results, err := Parse(append(good, truncated...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[0].Err != nil {
+			t.Fatalf("Parse = %+v, want the first record and an error", results)
+		}
+		if results[1].Err == nil || results[1].Err.Error() != "record is truncated" {
+			t.Errorf("truncated record error = %v", results[1].Err)
+		}
+	})
+}
+
+func TestParseXMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr bool
+		want    string
+	}{
+		{"malformed document", `<collection><record><leader>x</leader></collection>`, true, ""},
+		{"bad subfield code", `<record><datafield tag="245"><subfield code="ab">Title</subfield></datafield></record>`, false, `invalid subfield code "ab" in field 245`},
+		{"bad tag", `<record><controlfield tag="1">x</controlfield></record>`, false, `invalid control field tag "1"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Parse([]byte(tt.doc))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse = %+v, want an error", results)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != 1 || results[0].Err == nil || results[0].Err.Error() != tt.want {
+				t.Errorf("Parse = %+v, want the error %q", results, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	for _, file := range []string{"", " \n", `<?xml version="1.0"?><collection/>`} {
+		if _, err := Parse([]byte(file)); !errors.Is(err, ErrNoRecords) {
+			t.Errorf("Parse(%q) error = %v, want %v", file, err, ErrNoRecords)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Solaris /", "Solaris"},
+		{"Kraków :", "Kraków"},
+		{"Wydawnictwo Literackie,", "Wydawnictwo Literackie"},
+		{"Fantastyka naukowa.", "Fantastyka naukowa"},
+		{"Tolkien, J. R. R.", "Tolkien, J. R. R."},
+		{"  ", ""},
+	}
+	for _, tt := range tests {
+		if got := clean(tt.in); got != tt.want {
+			t.Errorf("clean(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestYearAndLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		field    Field
+		year     int
+		language string
+	}{
+		{"complete", field008("2008", "eng"), 2008, "eng"},
+		{"unknown year", field008("19uu", "pol"), 0, "pol"},
+		{"language not coded", field008("2008", "|||"), 2008, ""},
+		{"short field", Field{Tag: "008", Value: "240101s2008"}, 2008, ""},
+		{"missing", Field{Tag: "001", Value: "x"}, 0, ""},
+	}
+	for _, tt := range tests {
+		r := &Record{Fields: []Field{tt.field}}
+		if got := r.Year(); got != tt.year {
+			t.Errorf("%s: Year() = %d, want %d", tt.name, got, tt.year)
+		}
+		if got := r.Language(); got != tt.language {
+			t.Errorf("%s: Language() = %q, want %q", tt.name, got, tt.language)
+		}
+	}
+}
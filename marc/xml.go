@@ -0,0 +1,91 @@
+package marc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// xmlRecord is a MARCXML record element. Element names are matched whatever
+// their namespace, so files with and without the MARC21 slim namespace are
+// both read.
+type xmlRecord struct {
+	Leader        string `xml:"leader"`
+	ControlFields []struct {
+		Tag   string `xml:"tag,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"controlfield"`
+	DataFields []struct {
+		Tag       string `xml:"tag,attr"`
+		Ind1      string `xml:"ind1,attr"`
+		Ind2      string `xml:"ind2,attr"`
+		Subfields []struct {
+			Code  string `xml:"code,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"subfield"`
+	} `xml:"datafield"`
+}
+
+// parseXML reads every record element of a MARCXML document, which is either
+// a collection of records or a single record.
+func parseXML(data []byte) ([]Result, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var results []Result
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return results, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid MARCXML: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var raw xmlRecord
+		if err := decoder.DecodeElement(&raw, &start); err != nil {
+			return nil, fmt.Errorf("invalid MARCXML: %w", err)
+		}
+		record, err := raw.record()
+		if err != nil {
+			results = append(results, Result{Err: err})
+		} else {
+			results = append(results, Result{Record: record})
+		}
+	}
+}
+
+func (raw xmlRecord) record() (*Record, error) {
+	record := &Record{Leader: raw.Leader}
+	for _, f := range raw.ControlFields {
+		if len(f.Tag) != 3 {
+			return nil, fmt.Errorf("invalid control field tag %q", f.Tag)
+		}
+		record.Fields = append(record.Fields, Field{Tag: f.Tag, Value: f.Value})
+	}
+	for _, f := range raw.DataFields {
+		if len(f.Tag) != 3 {
+			return nil, fmt.Errorf("invalid data field tag %q", f.Tag)
+		}
+		field := Field{Tag: f.Tag, Ind1: indicator(f.Ind1), Ind2: indicator(f.Ind2)}
+		for _, s := range f.Subfields {
+			if len(s.Code) != 1 {
+				return nil, fmt.Errorf("invalid subfield code %q in field %s", s.Code, f.Tag)
+			}
+			field.Subfields = append(field.Subfields, Subfield{Code: s.Code[0], Value: s.Value})
+		}
+		record.Fields = append(record.Fields, field)
+	}
+	return record, nil
+}
+
+// indicator returns the indicator in an attribute, blank when it is empty.
+func indicator(value string) byte {
+	if value == "" {
+		return ' '
+	}
+	return value[0]
+}
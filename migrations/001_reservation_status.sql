@@ -0,0 +1,2 @@
+-- Status rezerwacji: oczekująca, gotowa do odbioru, zrealizowana
+ALTER TABLE Reservations ADD COLUMN Status VARCHAR(20) NOT NULL DEFAULT 'waiting';
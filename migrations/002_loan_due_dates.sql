@@ -0,0 +1,18 @@
+-- Termin zwrotu wypożyczenia
+ALTER TABLE Loans ADD COLUMN DueDate DATE AFTER LoanDate;
+UPDATE Loans SET DueDate = LoanDate + INTERVAL 30 DAY WHERE DueDate IS NULL;
+
+DROP PROCEDURE IF EXISTS LoanBook;
+DELIMITER //
+CREATE PROCEDURE LoanBook(IN book_id INT, IN user_id INT)
+BEGIN
+   INSERT INTO Loans (BookID, UserID, LoanDate, DueDate) VALUES (book_id, user_id, CURDATE(), CURDATE() + INTERVAL 30 DAY);
+END;
+//
+DELIMITER ;
+
+CREATE OR REPLACE VIEW UserLoanHistory AS
+SELECT Users.UserID, Users.Name, Books.Title, Loans.LoanDate, Loans.DueDate, Loans.ReturnDate
+FROM Users
+JOIN Loans ON Users.UserID = Loans.UserID
+JOIN Books ON Loans.BookID = Books.BookID;
@@ -0,0 +1,2 @@
+-- Licznik przedłużeń wypożyczenia
+ALTER TABLE Loans ADD COLUMN RenewalCount INT NOT NULL DEFAULT 0;
@@ -0,0 +1,44 @@
+-- Kary za przetrzymanie i księga zmian ich sald
+CREATE TABLE Fines (
+    FineID INT AUTO_INCREMENT PRIMARY KEY,
+    LoanID INT NOT NULL,
+    UserID INT NOT NULL,
+    Amount DECIMAL(10,2) NOT NULL,
+    Balance DECIMAL(10,2) NOT NULL,
+    Status VARCHAR(20) NOT NULL DEFAULT 'open',
+    AssessedDate DATE,
+    WaivedBy VARCHAR(100),
+    WaiveReason TEXT,
+    FOREIGN KEY (LoanID) REFERENCES Loans(LoanID),
+    FOREIGN KEY (UserID) REFERENCES Users(UserID)
+);
+
+-- Tabela FineTransactions (księga zmian sald kar, tylko do dopisywania)
+CREATE TABLE FineTransactions (
+    TransactionID INT AUTO_INCREMENT PRIMARY KEY,
+    FineID INT NOT NULL,
+    Type VARCHAR(20) NOT NULL,
+    Amount DECIMAL(10,2) NOT NULL,
+    BalanceAfter DECIMAL(10,2) NOT NULL,
+    RecordedBy VARCHAR(100),
+    Note TEXT,
+    CreatedAt DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (FineID) REFERENCES Fines(FineID)
+);
+
+DELIMITER //
+CREATE TRIGGER FineTransactionsNoUpdate
+BEFORE UPDATE ON FineTransactions
+FOR EACH ROW
+BEGIN
+   SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'FineTransactions is append-only';
+END;
+
+CREATE TRIGGER FineTransactionsNoDelete
+BEFORE DELETE ON FineTransactions
+FOR EACH ROW
+BEGIN
+   SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'FineTransactions is append-only';
+END;
+//
+DELIMITER ;
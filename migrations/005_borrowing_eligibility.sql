@@ -0,0 +1,13 @@
+-- Status i data ważności konta czytelnika
+ALTER TABLE Users ADD COLUMN Status VARCHAR(20) NOT NULL DEFAULT 'active';
+ALTER TABLE Users ADD COLUMN ExpiryDate DATE;
+
+DELIMITER //
+CREATE FUNCTION CountActiveUserLoans(user_id INT) RETURNS INT
+BEGIN
+   DECLARE loan_count INT;
+   SELECT COUNT(*) INTO loan_count FROM Loans WHERE UserID = user_id AND ReturnDate IS NULL;
+   RETURN loan_count;
+END;
+//
+DELIMITER ;
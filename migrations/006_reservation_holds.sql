@@ -0,0 +1,2 @@
+-- Termin odbioru książki odłożonej dla rezerwującego
+ALTER TABLE Reservations ADD COLUMN HoldUntil DATE;
@@ -0,0 +1,2 @@
+-- Hasła użytkowników (hash bcrypt) do logowania
+ALTER TABLE Users ADD COLUMN PasswordHash VARCHAR(255) AFTER Email;
@@ -0,0 +1,2 @@
+-- Role użytkowników: patron (czytelnik), librarian (bibliotekarz), admin
+ALTER TABLE Users ADD COLUMN Role VARCHAR(20) NOT NULL DEFAULT 'patron' AFTER PasswordHash;
@@ -0,0 +1,83 @@
+-- Fizyczne egzemplarze książek z kodem kreskowym, lokalizacją na półce i stanem.
+-- Dostępność książki wynika z liczby dostępnych egzemplarzy.
+CREATE TABLE Copies (
+    CopyID INT AUTO_INCREMENT PRIMARY KEY,
+    BookID INT NOT NULL,
+    Barcode VARCHAR(50) NOT NULL UNIQUE,
+    ShelfLocation VARCHAR(50),
+    CopyCondition VARCHAR(20) NOT NULL DEFAULT 'good',
+    Status VARCHAR(20) NOT NULL DEFAULT 'available',
+    FOREIGN KEY (BookID) REFERENCES Books(BookID)
+);
+
+-- Jeden egzemplarz dla każdej istniejącej książki. Książki niedostępne, których
+-- nikt nie wypożyczył ani nie odebrał, trafiają do sprawdzenia (in_repair).
+INSERT INTO Copies (BookID, Barcode, Status)
+SELECT BookID, CONCAT('BK', LPAD(BookID, 8, '0')),
+       CASE
+          WHEN EXISTS (SELECT 1 FROM Loans WHERE Loans.BookID = Books.BookID AND Loans.ReturnDate IS NULL) THEN 'on_loan'
+          WHEN EXISTS (SELECT 1 FROM Reservations WHERE Reservations.BookID = Books.BookID AND Reservations.Status = 'ready') THEN 'on_hold'
+          WHEN Available THEN 'available'
+          ELSE 'in_repair'
+       END
+FROM Books;
+
+ALTER TABLE Loans ADD COLUMN CopyID INT AFTER BookID, ADD FOREIGN KEY (CopyID) REFERENCES Copies(CopyID);
+UPDATE Loans JOIN Copies ON Copies.BookID = Loans.BookID SET Loans.CopyID = Copies.CopyID;
+
+ALTER TABLE Reservations ADD COLUMN CopyID INT, ADD FOREIGN KEY (CopyID) REFERENCES Copies(CopyID);
+UPDATE Reservations JOIN Copies ON Copies.BookID = Reservations.BookID SET Reservations.CopyID = Copies.CopyID WHERE Reservations.Status = 'ready';
+
+DROP TRIGGER IF EXISTS AfterBookLoan;
+DROP TRIGGER IF EXISTS BeforeBookReturn;
+DROP PROCEDURE IF EXISTS LoanBook;
+DROP FUNCTION IF EXISTS CheckBookAvailability;
+DELIMITER //
+CREATE TRIGGER AfterBookLoan
+AFTER INSERT ON Loans
+FOR EACH ROW
+BEGIN
+   IF NEW.ReturnDate IS NULL THEN
+      UPDATE Copies SET Status = 'on_loan' WHERE CopyID = NEW.CopyID;
+   END IF;
+END;
+
+CREATE TRIGGER BeforeBookReturn
+BEFORE UPDATE ON Loans
+FOR EACH ROW
+BEGIN
+   IF NEW.ReturnDate IS NOT NULL AND OLD.ReturnDate IS NULL THEN
+      UPDATE Copies SET Status = 'available' WHERE CopyID = OLD.CopyID;
+   END IF;
+END;
+
+CREATE PROCEDURE LoanBook(IN book_id INT, IN user_id INT)
+BEGIN
+   DECLARE copy_id INT;
+   SELECT CopyID INTO copy_id FROM Copies WHERE BookID = book_id AND Status = 'available' ORDER BY CopyID LIMIT 1 FOR UPDATE;
+   IF copy_id IS NULL THEN
+      SIGNAL SQLSTATE '45000' SET MESSAGE_TEXT = 'No copy of the book is available';
+   END IF;
+   INSERT INTO Loans (BookID, CopyID, UserID, LoanDate, DueDate) VALUES (book_id, copy_id, user_id, CURDATE(), CURDATE() + INTERVAL 30 DAY);
+END;
+
+CREATE FUNCTION CheckBookAvailability(book_id INT) RETURNS BOOLEAN
+BEGIN
+   RETURN EXISTS(SELECT 1 FROM Copies WHERE BookID = book_id AND Status = 'available');
+END;
+//
+DELIMITER ;
+
+DROP VIEW IF EXISTS AvailableBooks;
+ALTER TABLE Books DROP COLUMN Available;
+
+CREATE VIEW BookAvailability AS
+SELECT Books.BookID, Books.Title, Books.AuthorID, Books.PublisherID, Books.CategoryID,
+       COUNT(Copies.CopyID) AS TotalCopies,
+       COUNT(CASE WHEN Copies.Status = 'available' THEN 1 END) AS AvailableCopies
+FROM Books
+LEFT JOIN Copies ON Books.BookID = Copies.BookID
+GROUP BY Books.BookID;
+
+CREATE VIEW AvailableBooks AS
+SELECT * FROM BookAvailability WHERE AvailableCopies > 0;
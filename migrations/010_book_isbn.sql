@@ -0,0 +1,13 @@
+-- Numer ISBN książki przechowywany w postaci ISBN-13, bez łączników
+ALTER TABLE Books ADD COLUMN ISBN13 CHAR(13) UNIQUE AFTER Title;
+
+CREATE OR REPLACE VIEW BookAvailability AS
+SELECT Books.BookID, Books.Title, Books.ISBN13, Books.AuthorID, Books.PublisherID, Books.CategoryID,
+       COUNT(Copies.CopyID) AS TotalCopies,
+       COUNT(CASE WHEN Copies.Status = 'available' THEN 1 END) AS AvailableCopies
+FROM Books
+LEFT JOIN Copies ON Books.BookID = Copies.BookID
+GROUP BY Books.BookID;
+
+CREATE OR REPLACE VIEW AvailableBooks AS
+SELECT * FROM BookAvailability WHERE AvailableCopies > 0;
@@ -0,0 +1,36 @@
+-- Książka może mieć wielu współtwórców: autorów, redaktorów, tłumaczy
+-- i ilustratorów, w kolejności ze strony tytułowej. Dotychczasowy autor
+-- książki staje się jej jedynym współtwórcą z rolą 'author'.
+CREATE TABLE BookAuthors (
+    BookID INT NOT NULL,
+    AuthorID INT NOT NULL,
+    Role VARCHAR(20) NOT NULL DEFAULT 'author',
+    Position INT NOT NULL,
+    PRIMARY KEY (BookID, Position),
+    UNIQUE (BookID, AuthorID, Role),
+    FOREIGN KEY (BookID) REFERENCES Books(BookID) ON DELETE CASCADE,
+    FOREIGN KEY (AuthorID) REFERENCES Authors(AuthorID)
+);
+
+INSERT INTO BookAuthors (BookID, AuthorID, Role, Position)
+SELECT BookID, AuthorID, 'author', 1 FROM Books WHERE AuthorID IS NOT NULL;
+
+-- AuthorID w widoku to główny autor: pierwszy współtwórca z rolą 'author'
+CREATE OR REPLACE VIEW BookAvailability AS
+SELECT Books.BookID, Books.Title, Books.ISBN13,
+       (SELECT BookAuthors.AuthorID FROM BookAuthors
+        WHERE BookAuthors.BookID = Books.BookID AND BookAuthors.Role = 'author'
+        ORDER BY BookAuthors.Position LIMIT 1) AS AuthorID,
+       Books.PublisherID, Books.CategoryID,
+       COUNT(Copies.CopyID) AS TotalCopies,
+       COUNT(CASE WHEN Copies.Status = 'available' THEN 1 END) AS AvailableCopies
+FROM Books
+LEFT JOIN Copies ON Books.BookID = Copies.BookID
+GROUP BY Books.BookID;
+
+CREATE OR REPLACE VIEW AvailableBooks AS
+SELECT * FROM BookAvailability WHERE AvailableCopies > 0;
+
+-- Books_ibfk_1 to nadana automatycznie nazwa klucza obcego Books.AuthorID
+ALTER TABLE Books DROP FOREIGN KEY Books_ibfk_1;
+ALTER TABLE Books DROP COLUMN AuthorID;
@@ -0,0 +1,41 @@
+-- Kategorie tworzą drzewo (np. Fiction > Science Fiction), a książka może
+-- mieć wiele haseł przedmiotowych. Dotychczasowa kategoria książki staje się
+-- jej jedynym, a więc głównym hasłem.
+ALTER TABLE Categories ADD COLUMN ParentID INT;
+ALTER TABLE Categories ADD FOREIGN KEY (ParentID) REFERENCES Categories(CategoryID);
+
+CREATE TABLE BookCategories (
+    BookID INT NOT NULL,
+    CategoryID INT NOT NULL,
+    Position INT NOT NULL,
+    PRIMARY KEY (BookID, CategoryID),
+    UNIQUE (BookID, Position),
+    FOREIGN KEY (BookID) REFERENCES Books(BookID) ON DELETE CASCADE,
+    FOREIGN KEY (CategoryID) REFERENCES Categories(CategoryID)
+);
+
+INSERT INTO BookCategories (BookID, CategoryID, Position)
+SELECT BookID, CategoryID, 1 FROM Books WHERE CategoryID IS NOT NULL;
+
+-- CategoryID w widoku to kategoria główna: pierwsze hasło przedmiotowe
+CREATE OR REPLACE VIEW BookAvailability AS
+SELECT Books.BookID, Books.Title, Books.ISBN13,
+       (SELECT BookAuthors.AuthorID FROM BookAuthors
+        WHERE BookAuthors.BookID = Books.BookID AND BookAuthors.Role = 'author'
+        ORDER BY BookAuthors.Position LIMIT 1) AS AuthorID,
+       Books.PublisherID,
+       (SELECT BookCategories.CategoryID FROM BookCategories
+        WHERE BookCategories.BookID = Books.BookID
+        ORDER BY BookCategories.Position LIMIT 1) AS CategoryID,
+       COUNT(Copies.CopyID) AS TotalCopies,
+       COUNT(CASE WHEN Copies.Status = 'available' THEN 1 END) AS AvailableCopies
+FROM Books
+LEFT JOIN Copies ON Books.BookID = Copies.BookID
+GROUP BY Books.BookID;
+
+CREATE OR REPLACE VIEW AvailableBooks AS
+SELECT * FROM BookAvailability WHERE AvailableCopies > 0;
+
+-- Books_ibfk_3 to nadana automatycznie nazwa klucza obcego Books.CategoryID
+ALTER TABLE Books DROP FOREIGN KEY Books_ibfk_3;
+ALTER TABLE Books DROP COLUMN CategoryID;
@@ -0,0 +1,27 @@
+-- Klasyfikacja książek (UKD lub Dewey) i generowane z niej sygnatury.
+-- CallNumberSort to klucz sygnatury, po którym sortowanie bajtowe daje
+-- kolejność książek na półce.
+ALTER TABLE Books ADD COLUMN ClassificationScheme VARCHAR(3);
+ALTER TABLE Books ADD COLUMN Classification VARCHAR(100);
+ALTER TABLE Books ADD COLUMN CallNumber VARCHAR(150);
+ALTER TABLE Books ADD COLUMN CallNumberSort VARCHAR(255) CHARACTER SET ascii COLLATE ascii_bin;
+ALTER TABLE Books ADD INDEX (CallNumberSort);
+
+CREATE OR REPLACE VIEW BookAvailability AS
+SELECT Books.BookID, Books.Title, Books.ISBN13,
+       (SELECT BookAuthors.AuthorID FROM BookAuthors
+        WHERE BookAuthors.BookID = Books.BookID AND BookAuthors.Role = 'author'
+        ORDER BY BookAuthors.Position LIMIT 1) AS AuthorID,
+       Books.PublisherID,
+       (SELECT BookCategories.CategoryID FROM BookCategories
+        WHERE BookCategories.BookID = Books.BookID
+        ORDER BY BookCategories.Position LIMIT 1) AS CategoryID,
+       Books.ClassificationScheme, Books.Classification, Books.CallNumber, Books.CallNumberSort,
+       COUNT(Copies.CopyID) AS TotalCopies,
+       COUNT(CASE WHEN Copies.Status = 'available' THEN 1 END) AS AvailableCopies
+FROM Books
+LEFT JOIN Copies ON Books.BookID = Copies.BookID
+GROUP BY Books.BookID;
+
+CREATE OR REPLACE VIEW AvailableBooks AS
+SELECT * FROM BookAvailability WHERE AvailableCopies > 0;
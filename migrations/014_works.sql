@@ -0,0 +1,46 @@
+-- Utwory grupują wydania i przekłady tej samej książki, a serie utwory.
+-- Książka staje się wydaniem utworu, z rokiem wydania i językiem; tłumacze
+-- są już jej współtwórcami. Istniejące książki nie są przypisywane do utworów.
+-- Rezerwacja może dotyczyć utworu: zrealizuje ją egzemplarz dowolnego wydania.
+CREATE TABLE Series (
+    SeriesID INT AUTO_INCREMENT PRIMARY KEY,
+    Name VARCHAR(100),
+    Description TEXT
+);
+
+CREATE TABLE Works (
+    WorkID INT AUTO_INCREMENT PRIMARY KEY,
+    Title VARCHAR(100),
+    OriginalLanguage CHAR(3),
+    SeriesID INT,
+    SeriesVolume INT,
+    FOREIGN KEY (SeriesID) REFERENCES Series(SeriesID)
+);
+
+ALTER TABLE Books ADD COLUMN WorkID INT;
+ALTER TABLE Books ADD COLUMN PublicationYear SMALLINT;
+ALTER TABLE Books ADD COLUMN Language CHAR(3);
+ALTER TABLE Books ADD FOREIGN KEY (WorkID) REFERENCES Works(WorkID);
+
+ALTER TABLE Reservations ADD COLUMN WorkID INT;
+ALTER TABLE Reservations ADD FOREIGN KEY (WorkID) REFERENCES Works(WorkID);
+
+CREATE OR REPLACE VIEW BookAvailability AS
+SELECT Books.BookID, Books.Title, Books.ISBN13,
+       (SELECT BookAuthors.AuthorID FROM BookAuthors
+        WHERE BookAuthors.BookID = Books.BookID AND BookAuthors.Role = 'author'
+        ORDER BY BookAuthors.Position LIMIT 1) AS AuthorID,
+       Books.PublisherID,
+       (SELECT BookCategories.CategoryID FROM BookCategories
+        WHERE BookCategories.BookID = Books.BookID
+        ORDER BY BookCategories.Position LIMIT 1) AS CategoryID,
+       Books.WorkID, Books.PublicationYear, Books.Language,
+       Books.ClassificationScheme, Books.Classification, Books.CallNumber, Books.CallNumberSort,
+       COUNT(Copies.CopyID) AS TotalCopies,
+       COUNT(CASE WHEN Copies.Status = 'available' THEN 1 END) AS AvailableCopies
+FROM Books
+LEFT JOIN Copies ON Books.BookID = Copies.BookID
+GROUP BY Books.BookID;
+
+CREATE OR REPLACE VIEW AvailableBooks AS
+SELECT * FROM BookAvailability WHERE AvailableCopies > 0;
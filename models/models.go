@@ -2,60 +2,337 @@ package models
 
 import "time"
 
+// Book is a bibliographic record. Available, TotalCopies and AvailableCopies
+// are derived from the book's copies and ignored on create and update; Copies
+// is only filled in when a single book is read. Either ISBN form may be sent,
+// with or without hyphens; both are returned, ISBN10 only for ISBN-13s that
+// have one.
+//
+// Contributors lists the people credited on the book in order. AuthorID is
+// the main author, the first contributor with the author role; on create and
+// update it is only used when no contributors are sent, as the sole author.
+// Likewise Subjects lists the categories the book is filed under and
+// CategoryID is the first of them, its main category.
+//
+// PublisherID is 0 for a book with no publisher.
+//
+// A book is one edition of a work: WorkID links the editions and translations
+// of the same work, 0 for a book not linked to one. Language is the edition's
+// MARC language code, such as "pol" or "eng"; its translators are among its
+// contributors.
 type Book struct {
-	BookID        int     `json:"book_id"`
-	Title         string  `json:"title"`
-	AuthorID      int     `json:"author_id"`
-	PublisherID   int     `json:"publisher_id"`
-	CategoryID    int     `json:"category_id"`
-	Available     bool    `json:"available"`
-	AverageRating float64 `json:"average_rating,omitempty"`
+	BookID          int           `json:"book_id"`
+	Title           string        `json:"title" binding:"required,max=100"`
+	ISBN10          string        `json:"isbn_10"`
+	ISBN13          string        `json:"isbn_13"`
+	AuthorID        int           `json:"author_id" binding:"min=0"`
+	Contributors    []Contributor `json:"contributors" binding:"dive"`
+	PublisherID     int           `json:"publisher_id" binding:"omitempty,min=1"`
+	CategoryID      int           `json:"category_id" binding:"min=0"`
+	Subjects        []Subject     `json:"subjects" binding:"dive"`
+	WorkID          int           `json:"work_id" binding:"min=0"`
+	PublicationYear int           `json:"publication_year" binding:"omitempty,min=1450,maxyear=1"`
+	Language        string        `json:"language" binding:"omitempty,len=3,alpha"`
+	// Classification is a UKD (scheme udc) or Dewey (scheme ddc) number. The
+	// call number is generated from it when the book is saved.
+	ClassificationScheme string  `json:"classification_scheme"`
+	Classification       string  `json:"classification" binding:"max=100"`
+	CallNumber           string  `json:"call_number"`
+	Available            bool    `json:"available"`
+	TotalCopies          int     `json:"total_copies"`
+	AvailableCopies      int     `json:"available_copies"`
+	AverageRating        float64 `json:"average_rating,omitempty"`
+	Copies               []Copy  `json:"copies,omitempty"`
 }
 
+// Roles of the contributors to a book.
+const (
+	ContributorAuthor      = "author"
+	ContributorEditor      = "editor"
+	ContributorTranslator  = "translator"
+	ContributorIllustrator = "illustrator"
+)
+
+// Subject is a category a book is filed under. Name is filled in when the
+// book is read and ignored on write.
+type Subject struct {
+	CategoryID int    `json:"category_id" binding:"required,min=1"`
+	Name       string `json:"name"`
+}
+
+// Contributor is an author credited on a book in one role. Role defaults to
+// author; Name is filled in when the book is read and ignored on write.
+type Contributor struct {
+	AuthorID int    `json:"author_id" binding:"required,min=1"`
+	Name     string `json:"name"`
+	Role     string `json:"role" binding:"omitempty,oneof=author editor translator illustrator"`
+}
+
+// Copy statuses. Copies go on loan and on hold through circulation; the other
+// statuses are set by librarians. Only available copies can be checked out.
+const (
+	CopyAvailable = "available"
+	CopyOnLoan    = "on_loan"
+	CopyOnHold    = "on_hold"
+	CopyInRepair  = "in_repair"
+	CopyLost      = "lost"
+	CopyWithdrawn = "withdrawn"
+)
+
+// Physical conditions of a copy.
+const (
+	ConditionNew     = "new"
+	ConditionGood    = "good"
+	ConditionFair    = "fair"
+	ConditionPoor    = "poor"
+	ConditionDamaged = "damaged"
+)
+
+// Copy is a physical item of a book, identified by the barcode on its label.
+// BookID is ignored on update. Librarians may only set the shelf statuses;
+// copies go on loan and on hold through circulation.
+type Copy struct {
+	CopyID        int    `json:"copy_id"`
+	BookID        int    `json:"book_id" binding:"min=0"`
+	Barcode       string `json:"barcode" binding:"required,max=50"`
+	ShelfLocation string `json:"shelf_location" binding:"max=50"`
+	Condition     string `json:"condition" binding:"omitempty,oneof=new good fair poor damaged"`
+	Status        string `json:"status" binding:"omitempty,oneof=available in_repair lost withdrawn"`
+}
+
+// User account statuses.
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+)
+
+// User roles. Librarians can do everything patrons can, and admins everything
+// librarians can.
+const (
+	RolePatron    = "patron"
+	RoleLibrarian = "librarian"
+	RoleAdmin     = "admin"
+)
+
+// User is a library account. Password is only accepted on create and update;
+// it is stored as a bcrypt hash and never returned, and is limited to the 72
+// bytes bcrypt uses.
+//
+// On update an ExpiryDate left out keeps the stored date; ClearExpiry removes
+// it, so the account no longer expires. ClearExpiry is never returned.
 type User struct {
-	UserID int    `json:"user_id"`
-	Name   string `json:"name"`
-	Email  string `json:"email"`
+	UserID      int        `json:"user_id"`
+	Name        string     `json:"name" binding:"required,max=100"`
+	Email       string     `json:"email" binding:"required,email,max=100" format:"email"`
+	Password    string     `json:"password,omitempty" binding:"maxbytes=72" maxLength:"72"`
+	Role        string     `json:"role" binding:"omitempty,oneof=patron librarian admin"`
+	Status      string     `json:"status" binding:"omitempty,oneof=active suspended"`
+	ExpiryDate  *time.Time `json:"expiry_date"`
+	ClearExpiry bool       `json:"clear_expiry,omitempty"`
+}
+
+type Credentials struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TokenPair is returned on login and refresh. ExpiresIn is the lifetime of
+// the access token in seconds.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// SearchResult is a book found by a catalogue search with its relevance.
+type SearchResult struct {
+	Book
+	Score float64 `json:"score"`
+}
+
+// Suggestion is an autocomplete match. Fuzzy is set when it only matched
+// with a typo.
+type Suggestion struct {
+	Type  string `json:"type"`
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+	Fuzzy bool   `json:"fuzzy"`
 }
 
 type Author struct {
 	AuthorID  int    `json:"author_id"`
-	Name      string `json:"name"`
+	Name      string `json:"name" binding:"required,max=100"`
 	Biography string `json:"biography"`
 }
 
 type Publisher struct {
 	PublisherID int    `json:"publisher_id"`
-	Name        string `json:"name"`
+	Name        string `json:"name" binding:"required,max=100"`
 	Address     string `json:"address"`
 }
 
-type Category struct {
-	CategoryID  int    `json:"category_id"`
-	Name        string `json:"name"`
+// Series is a numbered series of works, such as a cycle of novels. Works is
+// only filled in when a single series is read, in volume order.
+type Series struct {
+	SeriesID    int    `json:"series_id"`
+	Name        string `json:"name" binding:"required,max=100"`
 	Description string `json:"description"`
+	Works       []Work `json:"works,omitempty"`
+}
+
+// Work is a book as its author wrote it, grouping its editions and
+// translations. SeriesID and SeriesVolume place it in a series, nil when it
+// is not in one. Editions is only filled in when a single work is read.
+type Work struct {
+	WorkID           int    `json:"work_id"`
+	Title            string `json:"title" binding:"required,max=100"`
+	OriginalLanguage string `json:"original_language" binding:"omitempty,len=3,alpha"`
+	SeriesID         *int   `json:"series_id"`
+	SeriesVolume     *int   `json:"series_volume"`
+	Editions         []Book `json:"editions,omitempty"`
 }
 
+// Category is a subject heading. ParentID is the broader category it belongs
+// to, nil for a top-level category; Children are only filled in by the
+// category tree.
+type Category struct {
+	CategoryID  int        `json:"category_id"`
+	Name        string     `json:"name" binding:"required,max=100"`
+	Description string     `json:"description"`
+	ParentID    *int       `json:"parent_id"`
+	Children    []Category `json:"children,omitempty"`
+}
+
+// Loan is a single checkout. Overdue and DaysOverdue are computed when the
+// loan is read: DaysOverdue counts the days past DueDate up to the return
+// date, or up to today while the book is still out. CopyID is the physical
+// copy that was lent.
 type Loan struct {
-	LoanID     int        `json:"loan_id"`
-	BookID     int        `json:"book_id"`
-	UserID     int        `json:"user_id"`
-	LoanDate   *time.Time `json:"loan_date"`
-	ReturnDate *time.Time `json:"return_date"`
+	LoanID       int        `json:"loan_id"`
+	BookID       int        `json:"book_id" binding:"min=0"`
+	CopyID       int        `json:"copy_id" binding:"min=0"`
+	UserID       int        `json:"user_id" binding:"min=0"`
+	LoanDate     *time.Time `json:"loan_date"`
+	DueDate      *time.Time `json:"due_date"`
+	ReturnDate   *time.Time `json:"return_date"`
+	RenewalCount int        `json:"renewal_count"`
+	Overdue      bool       `json:"overdue"`
+	DaysOverdue  int        `json:"days_overdue"`
 }
 
+// Reservation statuses. A reservation waits in the queue until a copy of the
+// book is returned, is then held ready for pickup until HoldUntil, and is
+// fulfilled once the patron checks the book out or expires if they do not.
+const (
+	ReservationWaiting   = "waiting"
+	ReservationReady     = "ready"
+	ReservationFulfilled = "fulfilled"
+	ReservationExpired   = "expired"
+)
+
+// Reservation is a place in a book's FIFO queue. QueuePosition is 1 for the
+// next patron in line and is only set while the reservation is waiting.
+// CopyID is the copy held for pickup while the reservation is ready.
+//
+// A reservation placed on a work rather than a book has a WorkID and is
+// fulfilled by a copy of any of its editions; its BookID is 0 until a copy is
+// held for it, and is then the edition of that copy.
 type Reservation struct {
-	ReservationID   int       `json:"reservation_id"`
-	BookID          int       `json:"book_id"`
-	UserID          int       `json:"user_id"`
-	ReservationDate time.Time `json:"reservation_date"`
+	ReservationID   int        `json:"reservation_id"`
+	BookID          int        `json:"book_id" binding:"min=0"`
+	WorkID          *int       `json:"work_id" binding:"omitempty,min=0"`
+	UserID          int        `json:"user_id" binding:"min=0"`
+	ReservationDate time.Time  `json:"reservation_date"`
+	Status          string     `json:"status"`
+	HoldUntil       *time.Time `json:"hold_until"`
+	CopyID          *int       `json:"copy_id"`
+	QueuePosition   int        `json:"queue_position,omitempty"`
+}
+
+// LoanReturn is the outcome of returning a loan. ReservationID is set when the
+// book is now held for a patron who reserved it, Fine when the book came back
+// late.
+type LoanReturn struct {
+	Loan          Loan  `json:"loan"`
+	ReservationID *int  `json:"reservation_id,omitempty"`
+	Fine          *Fine `json:"fine,omitempty"`
+}
+
+// Fine statuses.
+const (
+	FineOpen   = "open"
+	FinePaid   = "paid"
+	FineWaived = "waived"
+)
+
+// Fines ledger entry types.
+const (
+	LedgerAssessment = "assessment"
+	LedgerPayment    = "payment"
+	LedgerWaiver     = "waiver"
+)
+
+type Fine struct {
+	FineID       int               `json:"fine_id"`
+	LoanID       int               `json:"loan_id"`
+	UserID       int               `json:"user_id"`
+	Amount       float64           `json:"amount"`
+	Balance      float64           `json:"balance"`
+	Status       string            `json:"status"`
+	AssessedDate *time.Time        `json:"assessed_date"`
+	WaivedBy     string            `json:"waived_by,omitempty"`
+	WaiveReason  string            `json:"waive_reason,omitempty"`
+	Transactions []FineTransaction `json:"transactions,omitempty"`
+}
+
+// FineTransaction is an entry in the append-only fines ledger. Amount is
+// positive for assessments and negative for payments and waivers.
+type FineTransaction struct {
+	TransactionID int        `json:"transaction_id"`
+	FineID        int        `json:"fine_id"`
+	Type          string     `json:"type"`
+	Amount        float64    `json:"amount"`
+	BalanceAfter  float64    `json:"balance_after"`
+	RecordedBy    string     `json:"recorded_by,omitempty"`
+	Note          string     `json:"note,omitempty"`
+	CreatedAt     *time.Time `json:"created_at"`
+}
+
+// FinePayment is a payment taken at the desk. The librarian recording it is
+// the authenticated user.
+type FinePayment struct {
+	Amount float64 `json:"amount" binding:"required,min=0.01"`
+	Note   string  `json:"note"`
+}
+
+// FineWaiver cancels a fine. The librarian waiving it is the authenticated
+// user.
+type FineWaiver struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type EligibilityReason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Eligibility is the result of the borrowing check run before checkout.
+type Eligibility struct {
+	UserID   int                 `json:"user_id"`
+	Eligible bool                `json:"eligible"`
+	Reasons  []EligibilityReason `json:"reasons"`
 }
 
 type Review struct {
 	ReviewID int    `json:"review_id"`
-	BookID   int    `json:"book_id"`
-	UserID   int    `json:"user_id"`
-	Rating   int    `json:"rating"`
+	BookID   int    `json:"book_id" binding:"required,min=1"`
+	UserID   int    `json:"user_id" binding:"min=0"`
+	Rating   int    `json:"rating" binding:"required,min=1,max=5"`
 	Comment  string `json:"comment"`
 }
 
@@ -64,5 +341,103 @@ type UserLoanHistory struct {
 	UserName   string     `json:"user_name"`
 	BookTitle  string     `json:"book_title"`
 	LoanDate   *time.Time `json:"loan_date"`
+	DueDate    *time.Time `json:"due_date"`
 	ReturnDate *time.Time `json:"return_date"`
 }
+
+// Page is one page of a list endpoint. Next and Prev are the request URLs of
+// the neighbouring pages, or null at either end.
+type Page[T any] struct {
+	Items  []T     `json:"items"`
+	Total  int     `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+	Next   *string `json:"next"`
+	Prev   *string `json:"prev"`
+}
+
+// Outcomes of importing a record or one of the entities it refers to.
+const (
+	ImportCreated = "created"
+	ImportMatched = "matched"
+	ImportFailed  = "failed"
+)
+
+// ImportEntry is the outcome for a book, author, publisher or category named
+// by an imported record.
+type ImportEntry struct {
+	Type   string `json:"type"`
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// ImportRecord is the outcome of importing one record. Index is the position
+// of the record in the file, from 1. A failed record has an Error and no
+// entries, as nothing of it was saved.
+type ImportRecord struct {
+	Index         int           `json:"index"`
+	ControlNumber string        `json:"control_number,omitempty"`
+	Title         string        `json:"title,omitempty"`
+	Status        string        `json:"status"`
+	Error         string        `json:"error,omitempty"`
+	Entries       []ImportEntry `json:"entries,omitempty"`
+}
+
+// ImportReport counts the books created and matched and the records that
+// failed, with the outcome of every record.
+type ImportReport struct {
+	Created int            `json:"created"`
+	Matched int            `json:"matched"`
+	Failed  int            `json:"failed"`
+	Records []ImportRecord `json:"records"`
+}
+
+// CSVRowError is a problem with one row of an imported CSV file. Row is the
+// line of the file, the header being line 1. Column is empty when the problem
+// concerns the whole row.
+type CSVRowError struct {
+	Row    int    `json:"row"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+// CSVImportReport is the outcome of a CSV import. Rows counts the data rows of
+// the file and Imported those saved, which is none on a dry run or when any
+// row has errors.
+type CSVImportReport struct {
+	Resource string        `json:"resource"`
+	DryRun   bool          `json:"dry_run"`
+	Rows     int           `json:"rows"`
+	Imported int           `json:"imported"`
+	Errors   []CSVRowError `json:"errors"`
+}
+
+// Problem is an error response in the RFC 7807 problem details format, sent
+// as application/problem+json. Code identifies the kind of problem for
+// clients, such as "duplicate" or "still_referenced"; Detail explains it to a
+// person and Instance is the path of the request. The remaining members
+// extend the problem for some codes: Errors lists the fields of a request
+// body that failed validation, Reasons why a patron may not borrow, and
+// Report the rows of a CSV file that cannot be imported.
+type Problem struct {
+	Type     string              `json:"type"`
+	Title    string              `json:"title"`
+	Status   int                 `json:"status"`
+	Detail   string              `json:"detail,omitempty"`
+	Instance string              `json:"instance,omitempty"`
+	Code     string              `json:"code"`
+	Errors   []FieldError        `json:"errors,omitempty"`
+	Reasons  []EligibilityReason `json:"reasons,omitempty"`
+	Report   *CSVImportReport    `json:"report,omitempty"`
+}
+
+// FieldError is a field of a request body that breaks a validation rule.
+// Field is the JSON path of the field, such as "title" or
+// "contributors[0].author_id", and Rule the name of the rule, such as
+// "required", "max" or "email".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,39 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// polishFolds maps the lower-case Polish letters with diacritics to the
+// letters they are typed as on a keyboard without Polish layout.
+var polishFolds = map[rune]rune{
+	'ą': 'a',
+	'ć': 'c',
+	'ę': 'e',
+	'ł': 'l',
+	'ń': 'n',
+	'ó': 'o',
+	'ś': 's',
+	'ź': 'z',
+	'ż': 'z',
+}
+
+// Fold lower-cases s and strips Polish diacritics, so that "Książka" and
+// "ksiazka" fold to the same text.
+func Fold(s string) string {
+	return strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if base, ok := polishFolds[r]; ok {
+			return base
+		}
+		return r
+	}, s)
+}
+
+// Tokens folds s and splits it into words made of letters and digits.
+func Tokens(s string) []string {
+	return strings.FieldsFunc(Fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
@@ -0,0 +1,43 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Książka", "ksiazka"},
+		{"ZAŻÓŁĆ GĘŚLĄ JAŹŃ", "zazolc gesla jazn"},
+		{"zażółć gęślą jaźń", "zazolc gesla jazn"},
+		{"Łódź", "lodz"},
+		{"Tolkien", "tolkien"},
+		{"Müller", "müller"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Fold(tt.in); got != tt.want {
+			t.Errorf("Fold(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Pan Tadeusz", []string{"pan", "tadeusz"}},
+		{"Sienkiewicz, H. — Potop (1886)", []string{"sienkiewicz", "h", "potop", "1886"}},
+		{"jan.kowalski@example.com", []string{"jan", "kowalski", "example", "com"}},
+		{"Żółć", []string{"zolc"}},
+		{" -- ", nil},
+	}
+	for _, tt := range tests {
+		if got := Tokens(tt.in); len(got)+len(tt.want) > 0 && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokens(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
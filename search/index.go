@@ -0,0 +1,341 @@
+// Package search is an in-memory full-text index of the catalogue. Books are
+// found by the words of their title, of their authors' names and biographies
+// and of their categories' names, with Polish diacritics folded on both sides.
+// The same index suggests books, authors and users as their names are typed.
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Weights of a word by the field it was found in. A book matching a query in
+// its title ranks above one that only matches through its category.
+const (
+	titleWeight     = 4
+	authorWeight    = 3
+	categoryWeight  = 2
+	biographyWeight = 1
+)
+
+// A query word of at least minPrefixLength letters also matches longer
+// indexed words that start with it, at prefixFactor of the full weight. This
+// lets "ksiazk" find "Książka" and "Książki".
+const (
+	minPrefixLength = 3
+	prefixFactor    = 0.5
+)
+
+type kind int
+
+const (
+	kindBook kind = iota
+	kindAuthor
+	kindCategory
+)
+
+// document identifies an indexed book, author or category.
+type document struct {
+	kind kind
+	id   int
+}
+
+// Hit is a book matching a query with its relevance score.
+type Hit struct {
+	BookID int
+	Score  float64
+}
+
+// Index maps folded words to the documents they appear in. Authors and
+// categories are indexed once and linked to their books, so renaming an
+// author does not require reindexing each of the author's books. The indexed
+// words are also kept in sorted order, so that the words starting with a
+// query word are found by binary search. Alongside the full-text postings it
+// keeps a prefix index of book titles, author names and users for
+// autocompletion. An Index is safe for concurrent use.
+type Index struct {
+	mu            sync.RWMutex
+	postings      map[string]map[document]float64
+	terms         []string
+	loading       bool
+	words         map[document][]string
+	bookAuthors   map[int][]int
+	bookSubjects  map[int][]int
+	authorBooks   map[int]map[int]bool
+	categoryBooks map[int]map[int]bool
+	suggestions   map[string]*prefixIndex
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
+		postings:      map[string]map[document]float64{},
+		words:         map[document][]string{},
+		bookAuthors:   map[int][]int{},
+		bookSubjects:  map[int][]int{},
+		authorBooks:   map[int]map[int]bool{},
+		categoryBooks: map[int]map[int]bool{},
+		suggestions: map[string]*prefixIndex{
+			TypeBook:   newPrefixIndex(),
+			TypeAuthor: newPrefixIndex(),
+			TypeUser:   newPrefixIndex(),
+		},
+	}
+}
+
+// weigh adds the words of text to weights, keeping the highest weight of a
+// word found in several fields.
+func weigh(weights map[string]float64, text string, weight float64) {
+	for _, word := range Tokens(text) {
+		if weight > weights[word] {
+			weights[word] = weight
+		}
+	}
+}
+
+// StartLoad prepares the index to be filled with many records at once, as
+// at startup. Until FinishLoad the sorted word lists are not kept up to date,
+// so that each record is added in constant time, and the index must not be
+// searched.
+func (idx *Index) StartLoad() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.loading = true
+	for _, p := range idx.suggestions {
+		p.loading = true
+	}
+}
+
+// FinishLoad sorts the words added since StartLoad, once, and makes the index
+// ready for searching.
+func (idx *Index) FinishLoad() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.loading = false
+	idx.terms = make([]string, 0, len(idx.postings))
+	for word := range idx.postings {
+		idx.terms = append(idx.terms, word)
+	}
+	sort.Strings(idx.terms)
+	for _, p := range idx.suggestions {
+		p.finishLoad()
+	}
+}
+
+// put replaces the indexed words of a document. The caller must hold mu.
+func (idx *Index) put(doc document, weights map[string]float64) {
+	idx.remove(doc)
+	for word, weight := range weights {
+		if idx.postings[word] == nil {
+			idx.postings[word] = map[document]float64{}
+			if !idx.loading {
+				i := sort.SearchStrings(idx.terms, word)
+				idx.terms = append(idx.terms, "")
+				copy(idx.terms[i+1:], idx.terms[i:])
+				idx.terms[i] = word
+			}
+		}
+		idx.postings[word][doc] = weight
+		idx.words[doc] = append(idx.words[doc], word)
+	}
+}
+
+// remove drops every indexed word of a document. The caller must hold mu.
+func (idx *Index) remove(doc document) {
+	for _, word := range idx.words[doc] {
+		delete(idx.postings[word], doc)
+		if len(idx.postings[word]) == 0 {
+			delete(idx.postings, word)
+			if !idx.loading {
+				if i := sort.SearchStrings(idx.terms, word); i < len(idx.terms) && idx.terms[i] == word {
+					idx.terms = append(idx.terms[:i], idx.terms[i+1:]...)
+				}
+			}
+		}
+	}
+	delete(idx.words, doc)
+}
+
+func link(links map[int]map[int]bool, from, to int) {
+	if links[from] == nil {
+		links[from] = map[int]bool{}
+	}
+	links[from][to] = true
+}
+
+func unlink(links map[int]map[int]bool, from, to int) {
+	delete(links[from], to)
+	if len(links[from]) == 0 {
+		delete(links, from)
+	}
+}
+
+// PutBook indexes a new book or reindexes a changed one. The book is linked to
+// every author credited on it, whatever their role, and to every category it
+// is filed under.
+func (idx *Index) PutBook(id int, title string, authorIDs, categoryIDs []int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.unlinkBook(id)
+	weights := map[string]float64{}
+	weigh(weights, title, titleWeight)
+	idx.put(document{kindBook, id}, weights)
+	idx.bookAuthors[id] = authorIDs
+	idx.bookSubjects[id] = categoryIDs
+	for _, authorID := range authorIDs {
+		link(idx.authorBooks, authorID, id)
+	}
+	for _, categoryID := range categoryIDs {
+		link(idx.categoryBooks, categoryID, id)
+	}
+	idx.suggestions[TypeBook].put(id, title, title)
+}
+
+// DeleteBook removes a book from the index.
+func (idx *Index) DeleteBook(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.unlinkBook(id)
+	idx.remove(document{kindBook, id})
+	idx.suggestions[TypeBook].remove(id)
+}
+
+// unlinkBook drops a book's links to its authors and categories. The caller
+// must hold mu.
+func (idx *Index) unlinkBook(id int) {
+	for _, authorID := range idx.bookAuthors[id] {
+		unlink(idx.authorBooks, authorID, id)
+	}
+	delete(idx.bookAuthors, id)
+	for _, categoryID := range idx.bookSubjects[id] {
+		unlink(idx.categoryBooks, categoryID, id)
+	}
+	delete(idx.bookSubjects, id)
+}
+
+// PutAuthor indexes a new author or reindexes a changed one.
+func (idx *Index) PutAuthor(id int, name, biography string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	weights := map[string]float64{}
+	weigh(weights, biography, biographyWeight)
+	weigh(weights, name, authorWeight)
+	idx.put(document{kindAuthor, id}, weights)
+	idx.suggestions[TypeAuthor].put(id, name, name)
+}
+
+// DeleteAuthor removes an author from the index.
+func (idx *Index) DeleteAuthor(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(document{kindAuthor, id})
+	idx.suggestions[TypeAuthor].remove(id)
+}
+
+// PutCategory indexes a new category or reindexes a changed one.
+func (idx *Index) PutCategory(id int, name string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	weights := map[string]float64{}
+	weigh(weights, name, categoryWeight)
+	idx.put(document{kindCategory, id}, weights)
+}
+
+// DeleteCategory removes a category from the index.
+func (idx *Index) DeleteCategory(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(document{kindCategory, id})
+}
+
+// books returns the books a document stands for. The caller must hold mu.
+func (idx *Index) books(doc document) []int {
+	switch doc.kind {
+	case kindAuthor:
+		return keys(idx.authorBooks[doc.id])
+	case kindCategory:
+		return keys(idx.categoryBooks[doc.id])
+	default:
+		return []int{doc.id}
+	}
+}
+
+func keys(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// score raises the score in best of every book the indexed word is found in
+// to the word's weight times factor. The caller must hold mu.
+func (idx *Index) score(best map[int]float64, indexed string, factor float64) {
+	for doc, weight := range idx.postings[indexed] {
+		for _, bookID := range idx.books(doc) {
+			if weight*factor > best[bookID] {
+				best[bookID] = weight * factor
+			}
+		}
+	}
+}
+
+// Search returns the books matching every word of query, most relevant
+// first. A book scores the best weight of each query word across its title,
+// author and category; ties are broken by book ID.
+func (idx *Index) Search(query string) []Hit {
+	words := Tokens(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var scores map[int]float64
+	for _, word := range words {
+		best := map[int]float64{}
+		idx.score(best, word, 1)
+		if utf8.RuneCountInString(word) >= minPrefixLength {
+			for i := sort.SearchStrings(idx.terms, word); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], word); i++ {
+				if idx.terms[i] != word {
+					idx.score(best, idx.terms[i], prefixFactor)
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = best
+			continue
+		}
+		for bookID := range scores {
+			if weight, ok := best[bookID]; ok {
+				scores[bookID] += weight
+			} else {
+				delete(scores, bookID)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for bookID, score := range scores {
+		hits = append(hits, Hit{BookID: bookID, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].BookID < hits[j].BookID
+	})
+	return hits
+}
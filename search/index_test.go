@@ -0,0 +1,70 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newCatalogueIndex returns an index of a small catalogue, added one record
+// at a time or, with bulk set, between StartLoad and FinishLoad.
+func newCatalogueIndex(bulk bool) *Index {
+	idx := NewIndex()
+	if bulk {
+		idx.StartLoad()
+	}
+	idx.PutAuthor(1, "Stanisław Lem", "Polski pisarz fantastyki naukowej")
+	idx.PutAuthor(2, "Henryk Sienkiewicz", "")
+	idx.PutCategory(10, "Fantastyka naukowa")
+	idx.PutBook(100, "Solaris", []int{1}, []int{10})
+	idx.PutBook(101, "Cyberiada", []int{1}, []int{10})
+	idx.PutBook(102, "Potop", []int{2}, nil)
+	idx.PutBook(103, "Lemingi", nil, nil)
+	if bulk {
+		idx.FinishLoad()
+	}
+	return idx
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Hit
+	}{
+		{"Solaris", []Hit{{100, titleWeight}}},
+		{"lem", []Hit{{100, authorWeight}, {101, authorWeight}, {103, titleWeight * prefixFactor}}},
+		{"fantas", []Hit{{100, categoryWeight * prefixFactor}, {101, categoryWeight * prefixFactor}}},
+		{"lem solaris", []Hit{{100, authorWeight + titleWeight}}},
+		{"Sienkiewicz, Potop", []Hit{{102, authorWeight + titleWeight}}},
+		{"po", nil},
+		{"lem potop", nil},
+		{"", nil},
+	}
+	for _, bulk := range []bool{false, true} {
+		idx := newCatalogueIndex(bulk)
+		for _, tt := range tests {
+			if got := idx.Search(tt.query); len(got)+len(tt.want) > 0 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bulk %v: Search(%q) = %v, want %v", bulk, tt.query, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSearchAfterChanges(t *testing.T) {
+	for _, bulk := range []bool{false, true} {
+		idx := newCatalogueIndex(bulk)
+		idx.DeleteBook(100)
+		idx.PutBook(101, "Cyberiada", []int{2}, nil)
+		idx.DeleteAuthor(2)
+		idx.PutAuthor(2, "Henryk Sienkiewicz", "")
+		if got := idx.Search("solaris"); len(got) > 0 {
+			t.Errorf("bulk %v: deleted book found: %v", bulk, got)
+		}
+		want := []Hit{{101, authorWeight}, {102, authorWeight}}
+		if got := idx.Search("sienkiewicz"); !reflect.DeepEqual(got, want) {
+			t.Errorf("bulk %v: Search after relinking = %v, want %v", bulk, got, want)
+		}
+		if got := idx.Search("lem"); !reflect.DeepEqual(got, []Hit{{103, titleWeight * prefixFactor}}) {
+			t.Errorf("bulk %v: Search for an author without books = %v", bulk, got)
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Types of records that can be suggested.
+const (
+	TypeBook   = "book"
+	TypeAuthor = "author"
+	TypeUser   = "user"
+)
+
+// Suggestion is a record whose label matches what has been typed so far.
+// Fuzzy is set when a word only matched with a typo.
+type Suggestion struct {
+	ID    int
+	Label string
+	Fuzzy bool
+}
+
+// label is a suggested record: the text shown and the folded words it is
+// found by.
+type label struct {
+	text  string
+	words []string
+}
+
+// wordRef is one word of a label in the sorted word list.
+type wordRef struct {
+	word string
+	id   int
+}
+
+// prefixIndex keeps the words of every label in sorted order, so that the
+// labels with a word starting with what has been typed are found by binary
+// search. While loading is set, words is not kept up to date: it is rebuilt
+// with a single sort by finishLoad.
+type prefixIndex struct {
+	labels  map[int]label
+	words   []wordRef
+	loading bool
+}
+
+func newPrefixIndex() *prefixIndex {
+	return &prefixIndex{labels: map[int]label{}}
+}
+
+// search returns the position of the first word not below ref.
+func (p *prefixIndex) search(ref wordRef) int {
+	return sort.Search(len(p.words), func(i int) bool {
+		w := p.words[i]
+		return w.word > ref.word || (w.word == ref.word && w.id >= ref.id)
+	})
+}
+
+// put adds or replaces the label of a record, found by the words of
+// searchText.
+func (p *prefixIndex) put(id int, text, searchText string) {
+	p.remove(id)
+	words := Tokens(searchText)
+	p.labels[id] = label{text: text, words: words}
+	if p.loading {
+		return
+	}
+	for _, word := range words {
+		ref := wordRef{word, id}
+		i := p.search(ref)
+		if i < len(p.words) && p.words[i] == ref {
+			continue
+		}
+		p.words = append(p.words, wordRef{})
+		copy(p.words[i+1:], p.words[i:])
+		p.words[i] = ref
+	}
+}
+
+func (p *prefixIndex) remove(id int) {
+	old, ok := p.labels[id]
+	if !ok {
+		return
+	}
+	delete(p.labels, id)
+	if p.loading {
+		return
+	}
+	for _, word := range old.words {
+		ref := wordRef{word, id}
+		if i := p.search(ref); i < len(p.words) && p.words[i] == ref {
+			p.words = append(p.words[:i], p.words[i+1:]...)
+		}
+	}
+}
+
+// finishLoad rebuilds the sorted word list from the labels put while loading.
+func (p *prefixIndex) finishLoad() {
+	p.loading = false
+	p.words = p.words[:0]
+	for id, l := range p.labels {
+		for _, word := range l.words {
+			p.words = append(p.words, wordRef{word, id})
+		}
+	}
+	sort.Slice(p.words, func(i, j int) bool {
+		a, b := p.words[i], p.words[j]
+		return a.word < b.word || (a.word == b.word && a.id < b.id)
+	})
+	unique := p.words[:0]
+	for i, ref := range p.words {
+		if i == 0 || ref != p.words[i-1] {
+			unique = append(unique, ref)
+		}
+	}
+	p.words = unique
+}
+
+// maxEdits is the number of typos tolerated in a typed word. Short words must
+// match exactly, or almost every label would be suggested.
+func maxEdits(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// prefixDistance returns the smallest edit distance between typed and any
+// prefix of word, or edits+1 when it is larger than edits.
+func prefixDistance(typed, word string, edits int) int {
+	a, b := []rune(typed), []rune(word)
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev := row[0]
+		row[0] = i
+		rowMin := row[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current := min(row[j]+1, row[j-1]+1, prev+cost)
+			prev, row[j] = row[j], current
+			rowMin = min(rowMin, current)
+		}
+		if rowMin > edits {
+			return edits + 1
+		}
+	}
+	best := row[0]
+	for _, d := range row {
+		best = min(best, d)
+	}
+	return best
+}
+
+// match reports how a typed word matches a label: 0 when a word of the label
+// starts with it, 1 when it does so with typos, or -1 when nothing matches.
+func (l label) match(typed string) int {
+	result := -1
+	for _, word := range l.words {
+		if strings.HasPrefix(word, typed) {
+			return 0
+		}
+		if edits := maxEdits(typed); edits > 0 && prefixDistance(typed, word, edits) <= edits {
+			result = 1
+		}
+	}
+	return result
+}
+
+// suggest returns up to limit labels having, for every typed word, a word
+// that starts with it. Typos are tolerated only when there are not enough
+// exact prefix matches. Labels whose first word matches come first, then
+// shorter labels.
+func (p *prefixIndex) suggest(query string, limit int) []Suggestion {
+	typed := Tokens(query)
+	if len(typed) == 0 || limit <= 0 {
+		return nil
+	}
+
+	type candidate struct {
+		id      int
+		fuzzy   bool
+		leading bool
+	}
+	var candidates []candidate
+	seen := map[int]bool{}
+	consider := func(id int) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		l := p.labels[id]
+		fuzzy := false
+		for _, word := range typed {
+			switch l.match(word) {
+			case -1:
+				return
+			case 1:
+				fuzzy = true
+			}
+		}
+		leading := len(l.words) > 0 && strings.HasPrefix(l.words[0], typed[0])
+		candidates = append(candidates, candidate{id, fuzzy, leading})
+	}
+
+	for i := p.search(wordRef{typed[0], 0}); i < len(p.words) && strings.HasPrefix(p.words[i].word, typed[0]); i++ {
+		consider(p.words[i].id)
+	}
+	if len(candidates) < limit {
+		p.suggestFuzzy(typed[0], seen, consider)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.fuzzy != b.fuzzy {
+			return !a.fuzzy
+		}
+		if a.leading != b.leading {
+			return a.leading
+		}
+		la, lb := p.labels[a.id].text, p.labels[b.id].text
+		if len(la) != len(lb) {
+			return len(la) < len(lb)
+		}
+		if la != lb {
+			return la < lb
+		}
+		return a.id < b.id
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	suggestions := make([]Suggestion, len(candidates))
+	for i, c := range candidates {
+		suggestions[i] = Suggestion{ID: c.id, Label: p.labels[c.id].text, Fuzzy: c.fuzzy}
+	}
+	return suggestions
+}
+
+// suggestFuzzy considers the labels with a word that starts with typed but
+// for a few typos. Only words sharing the first letter of typed and long
+// enough to match are compared, which keeps the fallback from computing the
+// distance to every word on each keystroke.
+func (p *prefixIndex) suggestFuzzy(typed string, seen map[int]bool, consider func(id int)) {
+	edits := maxEdits(typed)
+	if edits == 0 {
+		return
+	}
+	first, size := utf8.DecodeRuneInString(typed)
+	if first == utf8.RuneError {
+		return
+	}
+	start := typed[:size]
+	minLength := utf8.RuneCountInString(typed) - edits
+	for i := p.search(wordRef{start, 0}); i < len(p.words) && strings.HasPrefix(p.words[i].word, start); i++ {
+		ref := p.words[i]
+		if seen[ref.id] || utf8.RuneCountInString(ref.word) < minLength {
+			continue
+		}
+		if prefixDistance(typed, ref.word, edits) <= edits {
+			consider(ref.id)
+		}
+	}
+}
+
+// PutUser adds a user to the suggestions, or updates a changed one. Users
+// are found by their name and email but are not part of the catalogue search.
+func (idx *Index) PutUser(id int, name, email string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.suggestions[TypeUser].put(id, name, name+" "+email)
+}
+
+// DeleteUser removes a user from the suggestions.
+func (idx *Index) DeleteUser(id int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.suggestions[TypeUser].remove(id)
+}
+
+// ValidType reports whether records of the given type can be suggested.
+func ValidType(recordType string) bool {
+	switch recordType {
+	case TypeBook, TypeAuthor, TypeUser:
+		return true
+	}
+	return false
+}
+
+// Suggest returns up to limit records of the given type whose label has, for
+// every word of query, a word starting with it. The last word may be
+// incomplete, as when the query is typed character by character.
+func (idx *Index) Suggest(recordType, query string, limit int) []Suggestion {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	p, ok := idx.suggestions[recordType]
+	if !ok {
+		return nil
+	}
+	return p.suggest(query, limit)
+}
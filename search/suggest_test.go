@@ -0,0 +1,126 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaxEdits(t *testing.T) {
+	tests := []struct {
+		word string
+		want int
+	}{
+		{"lem", 0},
+		{"prus", 1},
+		{"żółw", 1},
+		{"mickiewi", 2},
+		{"sienkiewicz", 2},
+	}
+	for _, tt := range tests {
+		if got := maxEdits(tt.word); got != tt.want {
+			t.Errorf("maxEdits(%q) = %d, want %d", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestPrefixDistance(t *testing.T) {
+	tests := []struct {
+		typed, word string
+		edits, want int
+	}{
+		{"sienk", "sienkiewicz", 1, 0},
+		{"sienkiewicz", "sienkiewicz", 2, 0},
+		{"sienkiwicz", "sienkiewicz", 2, 1},
+		{"sienkeiwicz", "sienkiewicz", 2, 2},
+		{"mickiewcz", "mickiewicz", 2, 1},
+		{"mickjewicz", "mickiewicz", 2, 1},
+		{"micki", "mickiewicz", 1, 0},
+		{"mocki", "mickiewicz", 1, 1},
+		{"wyspianski", "wyspianski", 2, 0},
+		{"abcd", "wxyz", 1, 2},
+		{"solaris", "lem", 2, 3},
+		{"", "lem", 1, 0},
+	}
+	for _, tt := range tests {
+		if got := prefixDistance(tt.typed, tt.word, tt.edits); got != tt.want {
+			t.Errorf("prefixDistance(%q, %q, %d) = %d, want %d", tt.typed, tt.word, tt.edits, got, tt.want)
+		}
+	}
+}
+
+var authors = map[int]string{
+	1: "Henryk Sienkiewicz",
+	2: "Stanisław Lem",
+	3: "Adam Mickiewicz",
+	4: "Stanisław Wyspiański",
+	5: "Bolesław Prus",
+}
+
+// newAuthorIndex returns an index of the authors, added one by one or, with
+// bulk set, between StartLoad and FinishLoad.
+func newAuthorIndex(bulk bool) *Index {
+	idx := NewIndex()
+	if bulk {
+		idx.StartLoad()
+	}
+	for id, name := range authors {
+		idx.PutAuthor(id, name, "")
+	}
+	if bulk {
+		idx.FinishLoad()
+	}
+	return idx
+}
+
+func TestSuggest(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []Suggestion
+	}{
+		{"stan", []Suggestion{{2, "Stanisław Lem", false}, {4, "Stanisław Wyspiański", false}}},
+		{"Stanisław W", []Suggestion{{4, "Stanisław Wyspiański", false}}},
+		{"lem stan", []Suggestion{{2, "Stanisław Lem", false}}},
+		{"wyspiań", []Suggestion{{4, "Stanisław Wyspiański", false}}},
+		{"ie", nil},
+		{"mickiewcz", []Suggestion{{3, "Adam Mickiewicz", true}}},
+		{"sienkiwicz", []Suggestion{{1, "Henryk Sienkiewicz", true}}},
+		{"boles prus", []Suggestion{{5, "Bolesław Prus", false}}},
+		{"plus", []Suggestion{{5, "Bolesław Prus", true}}},
+		{"zola", nil},
+		{"", nil},
+	}
+	for _, bulk := range []bool{false, true} {
+		idx := newAuthorIndex(bulk)
+		for _, tt := range tests {
+			if got := idx.Suggest(TypeAuthor, tt.query, 10); len(got)+len(tt.want) > 0 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bulk %v: Suggest(%q) = %+v, want %+v", bulk, tt.query, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSuggestAfterChanges(t *testing.T) {
+	for _, bulk := range []bool{false, true} {
+		idx := newAuthorIndex(bulk)
+		idx.DeleteAuthor(2)
+		idx.PutAuthor(4, "Stanisław Ignacy Witkiewicz", "")
+		idx.PutAuthor(6, "Stanisław Lem", "")
+		want := []Suggestion{{6, "Stanisław Lem", false}, {4, "Stanisław Ignacy Witkiewicz", false}}
+		if got := idx.Suggest(TypeAuthor, "stan", 10); !reflect.DeepEqual(got, want) {
+			t.Errorf("bulk %v: Suggest after changes = %+v, want %+v", bulk, got, want)
+		}
+		if got := idx.Suggest(TypeAuthor, "wysp", 10); len(got) > 0 {
+			t.Errorf("bulk %v: renamed author still suggested: %+v", bulk, got)
+		}
+	}
+}
+
+func TestSuggestLimit(t *testing.T) {
+	idx := newAuthorIndex(false)
+	if got := idx.Suggest(TypeAuthor, "stan", 1); len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("Suggest with limit 1 = %+v", got)
+	}
+	if got := idx.Suggest("publisher", "stan", 10); len(got) > 0 {
+		t.Errorf("Suggest of an unknown type = %+v", got)
+	}
+}